@@ -0,0 +1,180 @@
+package main
+
+// Node is embedded in every node of the syntax tree with the position of its
+// first token; for binary expressions it is the position of the operator.
+type Node struct {
+	Position Position
+}
+
+func (n Node) Pos() Position {
+	return n.Position
+}
+
+// Type is a type as written in the source: int, char, boolean, void or a
+// class name.
+type Type struct {
+	Node
+	Name string
+}
+
+// Var is a single variable of a declaration. Kind tells static and field
+// variables, parameters and local variables apart.
+type Var struct {
+	Node
+	Kind SymbolKind
+	Type Type
+	Name string
+}
+
+type Class struct {
+	Node
+	Name        string
+	Vars        []*Var
+	Subroutines []*Subroutine
+}
+
+// Subroutine is a constructor, function or method. End is the position of
+// the closing brace of its body.
+type Subroutine struct {
+	Node
+	Kind       KeyWord
+	ReturnType Type
+	Name       string
+	Parameters []*Var
+	Locals     []*Var
+	Body       []Statement
+	End        Position
+}
+
+type Statement interface {
+	Pos() Position
+	statement()
+}
+
+// LetStatement assigns Value to the variable Name, or to its element at
+// Index if Index is not nil.
+type LetStatement struct {
+	Node
+	Name         string
+	NamePosition Position
+	Index        Expression
+	Value        Expression
+}
+
+// IfStatement has a nil Else without an else branch.
+type IfStatement struct {
+	Node
+	Condition Expression
+	Then      []Statement
+	Else      []Statement
+}
+
+type WhileStatement struct {
+	Node
+	Condition Expression
+	Body      []Statement
+}
+
+type DoStatement struct {
+	Node
+	Call *CallExpression
+}
+
+// ReturnStatement has a nil Value for a plain return.
+type ReturnStatement struct {
+	Node
+	Value Expression
+}
+
+func (*LetStatement) statement()    {}
+func (*IfStatement) statement()     {}
+func (*WhileStatement) statement()  {}
+func (*DoStatement) statement()     {}
+func (*ReturnStatement) statement() {}
+
+type Expression interface {
+	Pos() Position
+	expression()
+}
+
+type IntegerConstant struct {
+	Node
+	Value int
+}
+
+type StringConstant struct {
+	Node
+	Value string
+}
+
+// KeywordConstant is true, false, null or this.
+type KeywordConstant struct {
+	Node
+	Keyword KeyWord
+}
+
+type VariableExpression struct {
+	Node
+	Name string
+}
+
+type IndexExpression struct {
+	Node
+	Name  string
+	Index Expression
+}
+
+// CallExpression calls Name on Receiver, a variable or a class name, or on
+// the current object if Receiver is empty.
+type CallExpression struct {
+	Node
+	Receiver  string
+	Name      string
+	Arguments []Expression
+}
+
+// UnaryExpression is a '-' or '~' applied to Operand.
+type UnaryExpression struct {
+	Node
+	Operator rune
+	Operand  Expression
+}
+
+// BinaryExpression applies one of + - * / & | < > = to Left and Right. Jack
+// has no precedence, so a chain of operators is evaluated from left to right
+// and becomes a tree leaning to the left, unless the parser is asked to use
+// conventional precedence.
+type BinaryExpression struct {
+	Node
+	Operator rune
+	Left     Expression
+	Right    Expression
+}
+
+// ShiftExpression shifts Operand Count times to the left, or to the right if
+// Right is set. It has no syntax of its own and is only made by the
+// optimizer.
+type ShiftExpression struct {
+	Node
+	Operand Expression
+	Count   int
+	Right   bool
+}
+
+// ParenExpression is an expression in parentheses, kept so that later passes
+// can tell how the source grouped its operators.
+type ParenExpression struct {
+	Node
+	Inner Expression
+}
+
+func (*IntegerConstant) expression()    {}
+func (*StringConstant) expression()     {}
+func (*KeywordConstant) expression()    {}
+func (*VariableExpression) expression() {}
+func (*IndexExpression) expression()    {}
+func (*CallExpression) expression()     {}
+func (*UnaryExpression) expression()    {}
+func (*BinaryExpression) expression()   {}
+func (*ShiftExpression) expression()    {}
+func (*ParenExpression) expression()    {}
@@ -0,0 +1,495 @@
+package main
+
+import "fmt"
+
+const (
+	// the type of an expression whose type is not known, after an error or
+	// for an element of an Array; it fits everywhere
+	typeAny = ""
+	// the type of null, which fits every class
+	typeNull = "null"
+
+	typeInt     = "int"
+	typeChar    = "char"
+	typeBoolean = "boolean"
+	typeVoid    = "void"
+	typeArray   = "Array"
+	typeString  = "String"
+)
+
+// Conversion tells whether a value of one type can be used where another
+// type is expected.
+type Conversion int
+
+const (
+	CONVERSION_NONE Conversion = iota
+	CONVERSION_IMPLICIT
+	CONVERSION_INVALID
+)
+
+// Checker is the semantic pass over the syntax tree of a class. It checks
+// the types of variables, expressions and return values and the calls of
+// subroutines against the signatures of all classes of the program and the
+// OS.
+type Checker struct {
+	file       string
+	errs       ErrorList
+	classes    map[string]*ClassInfo
+	class      *Class
+	subroutine *Subroutine
+	classVars  map[string]*Var
+	localVars  map[string]*Var
+
+	// the parameters and local variables of the subroutine that are read,
+	// that are assigned, and that were warned about being read unassigned
+	read          map[string]bool
+	written       map[string]bool
+	uninitialized map[string]bool
+}
+
+func NewChecker(file string, classes map[string]*ClassInfo) *Checker {
+	c := Checker{
+		file:    file,
+		classes: classes,
+	}
+
+	return &c
+}
+
+// Check checks class and returns the errors and warnings it finds in source
+// order.
+func (c *Checker) Check(class *Class) ErrorList {
+	c.class = class
+	c.classVars = make(map[string]*Var)
+
+	for _, v := range class.Vars {
+		c.checkType(v.Type)
+		c.declare(c.classVars, v)
+	}
+
+	subroutines := make(map[string]bool)
+	for _, subroutine := range class.Subroutines {
+		if subroutines[subroutine.Name] {
+			c.errorAt(subroutine.Position, "subroutine '%s' already declared", subroutine.Name)
+		}
+		subroutines[subroutine.Name] = true
+		c.checkSubroutine(subroutine)
+	}
+
+	c.errs.Sort()
+
+	return c.errs
+}
+
+// checkType reports t if it names a class that is neither declared by the
+// program nor by the OS
+func (c *Checker) checkType(t Type) {
+	if isPrimitive(t.Name) || t.Name == typeVoid {
+		return
+	}
+	if _, ok := c.classes[t.Name]; !ok {
+		c.errorAt(t.Position, "undefined class '%s'", t.Name)
+	}
+}
+
+func (c *Checker) declare(scope map[string]*Var, v *Var) {
+	if _, ok := scope[v.Name]; ok {
+		c.errorAt(v.Position, "variable '%s' already declared", v.Name)
+		return
+	}
+	scope[v.Name] = v
+}
+
+func (c *Checker) checkSubroutine(subroutine *Subroutine) {
+	c.subroutine = subroutine
+	c.localVars = make(map[string]*Var)
+
+	if subroutine.Kind == KEYWORD_CONSTRUCTOR && subroutine.ReturnType.Name != c.class.Name {
+		c.errorAt(subroutine.ReturnType.Position, "constructor must return %s, not %s", c.class.Name, subroutine.ReturnType.Name)
+	}
+
+	c.checkType(subroutine.ReturnType)
+
+	for _, v := range subroutine.Parameters {
+		c.checkType(v.Type)
+		c.declare(c.localVars, v)
+	}
+
+	for _, v := range subroutine.Locals {
+		c.checkType(v.Type)
+		c.declare(c.localVars, v)
+	}
+
+	c.checkStatements(subroutine.Body)
+	c.checkFlow(subroutine)
+}
+
+func (c *Checker) checkStatements(statements []Statement) {
+	for _, statement := range statements {
+		switch s := statement.(type) {
+		case *LetStatement:
+			c.checkLet(s)
+
+		case *IfStatement:
+			c.expect(s.Condition, typeBoolean, "condition")
+			c.checkStatements(s.Then)
+			c.checkStatements(s.Else)
+
+		case *WhileStatement:
+			c.expect(s.Condition, typeBoolean, "condition")
+			c.checkStatements(s.Body)
+
+		case *DoStatement:
+			c.typeOf(s.Call)
+
+		case *ReturnStatement:
+			c.checkReturn(s)
+		}
+	}
+}
+
+func (c *Checker) checkLet(let *LetStatement) {
+	v := c.lookupVar(let.Name, let.NamePosition)
+
+	if let.Index != nil {
+		if v != nil {
+			c.checkIndexable(v, let.NamePosition)
+		}
+		c.expect(let.Index, typeInt, "array index")
+		c.value(let.Value)
+		return
+	}
+
+	if v == nil {
+		c.value(let.Value)
+		return
+	}
+
+	c.expect(let.Value, v.Type.Name, fmt.Sprintf("assignment to '%s'", let.Name))
+}
+
+func (c *Checker) checkReturn(statement *ReturnStatement) {
+	returnType := c.subroutine.ReturnType.Name
+
+	switch {
+	case statement.Value == nil:
+		if returnType != typeVoid {
+			c.errorAt(statement.Position, "missing return value, %s.%s returns %s", c.class.Name, c.subroutine.Name, returnType)
+		}
+
+	case returnType == typeVoid:
+		c.errorAt(statement.Value.Pos(), "%s.%s is void and cannot return a value", c.class.Name, c.subroutine.Name)
+		c.value(statement.Value)
+
+	default:
+		c.expect(statement.Value, returnType, "return value")
+	}
+}
+
+// checkIndexable reports v if its value cannot be an address
+func (c *Checker) checkIndexable(v *Var, position Position) {
+	if isPrimitive(v.Type.Name) {
+		c.errorAt(position, "cannot index '%s' of type %s", v.Name, v.Type.Name)
+	}
+}
+
+// expect checks that e has a value that can be used as type t, in a context
+// named by what. An integer constant is a char without a warning, since Jack
+// has no character literals to write it with.
+func (c *Checker) expect(e Expression, t string, what string) {
+	from := c.value(e)
+	if _, ok := e.(*IntegerConstant); ok && t == typeChar {
+		return
+	}
+	c.convert(e.Pos(), from, t, what)
+}
+
+func (c *Checker) convert(position Position, from, to string, what string) {
+	switch convertType(from, to) {
+	case CONVERSION_IMPLICIT:
+		c.warnAt(position, "implicit conversion from %s to %s in %s", typeName(from), to, what)
+	case CONVERSION_INVALID:
+		c.errorAt(position, "cannot use %s as %s in %s", typeName(from), to, what)
+	}
+}
+
+// convertType tells how a value of type from is used as type to. Characters
+// widen to integers, while the other conversions between int, char and
+// boolean are implicit. Null is 0 and fits every type, as the OS uses it for
+// a missing object and a zero alike. Array is the type of a bare address: it
+// converts to and from int silently, as the OS does to manage memory, and
+// fits every class.
+func convertType(from, to string) Conversion {
+	switch {
+	case from == to || from == typeAny || to == typeAny:
+		return CONVERSION_NONE
+	case from == typeVoid || to == typeVoid:
+		return CONVERSION_INVALID
+	case from == typeNull:
+		return CONVERSION_NONE
+	case isPrimitive(from) && isPrimitive(to):
+		if from == typeChar && to == typeInt {
+			return CONVERSION_NONE
+		}
+		return CONVERSION_IMPLICIT
+	case from == typeInt && to == typeArray, from == typeArray && to == typeInt:
+		return CONVERSION_NONE
+	case isPrimitive(from) || isPrimitive(to):
+		return CONVERSION_INVALID
+	case from == typeArray || to == typeArray:
+		return CONVERSION_NONE
+	}
+	return CONVERSION_INVALID
+}
+
+func isPrimitive(t string) bool {
+	return t == typeInt || t == typeChar || t == typeBoolean
+}
+
+func typeName(t string) string {
+	if t == typeAny {
+		return "unknown type"
+	}
+	return t
+}
+
+// value returns the type of e, which must have a value
+func (c *Checker) value(e Expression) string {
+	t := c.typeOf(e)
+	if t == typeVoid {
+		for paren, ok := e.(*ParenExpression); ok; paren, ok = e.(*ParenExpression) {
+			e = paren.Inner
+		}
+		name := "expression"
+		switch e := e.(type) {
+		case *CallExpression:
+			name = c.callName(e)
+		case *VariableExpression:
+			name = fmt.Sprintf("variable '%s'", e.Name)
+		}
+		c.errorAt(e.Pos(), "%s is void and has no value", name)
+		return typeAny
+	}
+	return t
+}
+
+func (c *Checker) typeOf(expression Expression) string {
+	switch e := expression.(type) {
+	case *IntegerConstant:
+		return typeInt
+
+	case *StringConstant:
+		return typeString
+
+	case *KeywordConstant:
+		switch e.Keyword {
+		case KEYWORD_TRUE, KEYWORD_FALSE:
+			return typeBoolean
+		case KEYWORD_NULL:
+			return typeNull
+		}
+		if c.subroutine.Kind == KEYWORD_FUNCTION {
+			c.errorAt(e.Position, "'this' used in a function")
+			return typeAny
+		}
+		return c.class.Name
+
+	case *VariableExpression:
+		if v := c.lookupVar(e.Name, e.Position); v != nil {
+			return v.Type.Name
+		}
+		return typeAny
+
+	case *IndexExpression:
+		if v := c.lookupVar(e.Name, e.Position); v != nil {
+			c.checkIndexable(v, e.Position)
+		}
+		c.expect(e.Index, typeInt, "array index")
+		return typeAny
+
+	case *CallExpression:
+		return c.checkCall(e)
+
+	case *UnaryExpression:
+		if e.Operator == '~' {
+			t := c.value(e.Operand)
+			if t == typeBoolean {
+				return typeBoolean
+			}
+			c.convert(e.Operand.Pos(), t, typeInt, "operand of '~'")
+			return typeInt
+		}
+		c.expect(e.Operand, typeInt, "operand of '-'")
+		return typeInt
+
+	case *BinaryExpression:
+		return c.checkBinary(e)
+
+	case *ParenExpression:
+		return c.typeOf(e.Inner)
+	}
+
+	return typeAny
+}
+
+func (c *Checker) checkBinary(e *BinaryExpression) string {
+	what := fmt.Sprintf("operand of '%c'", e.Operator)
+	left, right := c.value(e.Left), c.value(e.Right)
+
+	switch e.Operator {
+	case '&', '|':
+		if isLogical(left) && isLogical(right) {
+			return typeBoolean
+		}
+		c.convert(e.Left.Pos(), left, typeInt, what)
+		c.convert(e.Right.Pos(), right, typeInt, what)
+		return typeInt
+
+	case '=':
+		conversion := convertType(left, right)
+		if back := convertType(right, left); back < conversion {
+			conversion = back
+		}
+		switch conversion {
+		case CONVERSION_IMPLICIT:
+			c.warnAt(e.Position, "implicit conversion comparing %s with %s", typeName(left), typeName(right))
+		case CONVERSION_INVALID:
+			c.errorAt(e.Position, "cannot compare %s with %s", typeName(left), typeName(right))
+		}
+		return typeBoolean
+
+	case '<', '>':
+		c.convert(e.Left.Pos(), left, typeInt, what)
+		c.convert(e.Right.Pos(), right, typeInt, what)
+		return typeBoolean
+	}
+
+	c.convert(e.Left.Pos(), left, typeInt, what)
+	c.convert(e.Right.Pos(), right, typeInt, what)
+	return typeInt
+}
+
+func isLogical(t string) bool {
+	return t == typeBoolean || t == typeAny
+}
+
+// checkCall checks a call against the signature of the subroutine it calls
+// and returns its return type. A call on a variable or on the current object
+// must call a method, a call on a class name a function or constructor.
+func (c *Checker) checkCall(call *CallExpression) string {
+	className := call.Receiver
+	onObject := true
+
+	switch {
+	case call.Receiver == "":
+		className = c.class.Name
+
+	case c.findVar(call.Receiver) != nil:
+		v := c.lookupVar(call.Receiver, call.Position)
+		if v == nil {
+			className = ""
+			break
+		}
+		className = v.Type.Name
+		if isPrimitive(className) {
+			c.errorAt(call.Position, "cannot call method '%s' on '%s' of type %s", call.Name, v.Name, className)
+			className = ""
+		}
+
+	default:
+		onObject = false
+		if _, ok := c.classes[className]; !ok {
+			c.errorAt(call.Position, "undefined class '%s'", className)
+		}
+	}
+
+	var signature *Signature
+	if info, ok := c.classes[className]; ok {
+		signature = info.Subroutines[call.Name]
+		if signature == nil {
+			c.errorAt(call.Position, "undefined subroutine %s.%s", className, call.Name)
+		}
+	}
+
+	switch {
+	case signature == nil:
+	case onObject && signature.Kind != KEYWORD_METHOD:
+		c.errorAt(call.Position, "%s %s called as a method", signature.Kind, signature)
+	case !onObject && signature.Kind == KEYWORD_METHOD:
+		c.errorAt(call.Position, "method %s called as a function", signature)
+	case call.Receiver == "" && c.subroutine.Kind == KEYWORD_FUNCTION:
+		c.errorAt(call.Position, "method %s called without an object in a function", signature)
+	}
+
+	if signature != nil && len(call.Arguments) != len(signature.Parameters) {
+		c.errorAt(call.Position, "%s expects %s, got %d", signature, plural(len(signature.Parameters), "argument"), len(call.Arguments))
+	}
+
+	for i, argument := range call.Arguments {
+		if signature == nil || i >= len(signature.Parameters) {
+			c.value(argument)
+			continue
+		}
+		c.expect(argument, signature.Parameters[i], fmt.Sprintf("argument %d of %s", i+1, signature))
+	}
+
+	if signature == nil {
+		return typeAny
+	}
+	return signature.ReturnType
+}
+
+func (c *Checker) callName(call *CallExpression) string {
+	if call.Receiver == "" {
+		return call.Name
+	}
+	return call.Receiver + "." + call.Name
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, word)
+	}
+	return fmt.Sprintf("%d %ss", n, word)
+}
+
+func (c *Checker) findVar(name string) *Var {
+	if v, ok := c.localVars[name]; ok {
+		return v
+	}
+	return c.classVars[name]
+}
+
+// lookupVar returns the variable name refers to, or reports it and returns
+// nil if it is not declared or is a field used in a function
+func (c *Checker) lookupVar(name string, position Position) *Var {
+	v := c.findVar(name)
+	if v == nil {
+		c.errorAt(position, "undefined variable '%s'", name)
+		return nil
+	}
+
+	if v.Kind == SYMBOL_FIELD && c.subroutine.Kind == KEYWORD_FUNCTION {
+		c.errorAt(position, "field '%s' used in a function", name)
+		return nil
+	}
+
+	return v
+}
+
+func (c *Checker) errorAt(position Position, format string, a ...interface{}) {
+	c.errs = append(c.errs, &Error{
+		File:     c.file,
+		Position: position,
+		Message:  fmt.Sprintf(format, a...),
+	})
+}
+
+func (c *Checker) warnAt(position Position, format string, a ...interface{}) {
+	c.errs = append(c.errs, &Error{
+		File:     c.file,
+		Position: position,
+		Message:  fmt.Sprintf(format, a...),
+		Warning:  true,
+	})
+}
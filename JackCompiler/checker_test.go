@@ -0,0 +1,224 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var diagnosticTests = []struct {
+	name    string
+	source  string
+	message string
+	warning bool
+}{
+	{
+		"void variable",
+		`class Main { function void main() { var void x; return; } }`,
+		"expected type but found 'void'", false,
+	},
+	{
+		"do without call",
+		`class Main { function void main() { do 1; return; } }`,
+		"expected subroutine call", false,
+	},
+	{
+		"left to right",
+		`class Main { function int f(int x) { return 1 + x * 2; } }`,
+		"'*' applies to the result of the operators before it, since Jack evaluates from left to right; use parentheses", true,
+	},
+	{
+		"subroutine declared twice",
+		`class Main { function void f() { return; } function void f() { return; } }`,
+		"subroutine 'f' already declared", false,
+	},
+	{
+		"undefined type",
+		`class Main { field Foo foo; }`,
+		"undefined class 'Foo'", false,
+	},
+	{
+		"variable declared twice",
+		`class Main { function void main() { var int x, x; let x = 1; do Output.printInt(x); return; } }`,
+		"variable 'x' already declared", false,
+	},
+	{
+		"constructor type",
+		`class Main { constructor int new() { return 0; } }`,
+		"constructor must return Main, not int", false,
+	},
+	{
+		"missing return value",
+		`class Main { function int f() { return; } }`,
+		"missing return value, Main.f returns int", false,
+	},
+	{
+		"void return value",
+		`class Main { function void f() { return 1; } }`,
+		"Main.f is void and cannot return a value", false,
+	},
+	{
+		"index of int",
+		`class Main { function int f(int x) { return x[0]; } }`,
+		"cannot index 'x' of type int", false,
+	},
+	{
+		"implicit conversion",
+		`class Main { function int f(boolean b) { return b; } }`,
+		"implicit conversion from boolean to int in return value", true,
+	},
+	{
+		"invalid conversion",
+		`class Main { function int f() { return "one"; } }`,
+		"cannot use String as int in return value", false,
+	},
+	{
+		"void call",
+		`class Main { function void f() { return; } function int g() { return Main.f(); } }`,
+		"Main.f is void and has no value", false,
+	},
+	{
+		"this in a function",
+		`class Main { function Main f() { return this; } }`,
+		"'this' used in a function", false,
+	},
+	{
+		"implicit comparison",
+		`class Main { function boolean f(boolean b) { return b = 1; } }`,
+		"implicit conversion comparing boolean with int", true,
+	},
+	{
+		"invalid comparison",
+		`class Main { function boolean f(String s) { return s = 1; } }`,
+		"cannot compare String with int", false,
+	},
+	{
+		"method of int",
+		`class Main { function int f(int x) { return x.length(); } }`,
+		"cannot call method 'length' on 'x' of type int", false,
+	},
+	{
+		"undefined class",
+		`class Main { function void f() { do Foo.bar(); return; } }`,
+		"undefined class 'Foo'", false,
+	},
+	{
+		"undefined subroutine",
+		`class Main { function void f() { do Main.g(); return; } }`,
+		"undefined subroutine Main.g", false,
+	},
+	{
+		"function called as a method",
+		`class Main { function void f() { return; } method void g() { do f(); return; } }`,
+		"function Main.f called as a method", false,
+	},
+	{
+		"method called as a function",
+		`class Main { method void f() { return; } function void g() { do Main.f(); return; } }`,
+		"method Main.f called as a function", false,
+	},
+	{
+		"method called in a function",
+		`class Main { method void f() { return; } function void g() { do f(); return; } }`,
+		"method Main.f called without an object in a function", false,
+	},
+	{
+		"argument count",
+		`class Main { function void f() { do Output.printInt(); return; } }`,
+		"Output.printInt expects 1 argument, got 0", false,
+	},
+	{
+		"undefined variable",
+		`class Main { function int f() { return x; } }`,
+		"undefined variable 'x'", false,
+	},
+	{
+		"field in a function",
+		`class Main { field int x; function int f() { return x; } }`,
+		"field 'x' used in a function", false,
+	},
+	{
+		"missing return",
+		`class Main { function int f(int x) { if (x > 0) { return x; } } }`,
+		"missing return at the end of Main.f", false,
+	},
+	{
+		"unused parameter",
+		`class Main { function int f(int x) { return 0; } }`,
+		"parameter 'x' is never used", true,
+	},
+	{
+		"local assigned but unused",
+		`class Main { function int f() { var int x; let x = 1; return 0; } }`,
+		"local variable 'x' is assigned but never used", true,
+	},
+	{
+		"unused local",
+		`class Main { function int f() { var int x; return 0; } }`,
+		"local variable 'x' is never used", true,
+	},
+	{
+		"unreachable",
+		`class Main { function int f() { return 0; do Output.println(); } }`,
+		"unreachable statement after return", true,
+	},
+	{
+		"read before assigned",
+		`class Main { function int f() { var int x; return x; } }`,
+		"local variable 'x' may be read before it is assigned", true,
+	},
+}
+
+func TestDiagnostics(t *testing.T) {
+	for _, test := range diagnosticTests {
+		t.Run(test.name, func(t *testing.T) {
+			diagnostics := check(t, test.source)
+			for _, e := range diagnostics {
+				if e.Message == test.message && e.Warning == test.warning {
+					return
+				}
+			}
+			t.Errorf("missing %q in:\n%v", test.message, diagnostics)
+		})
+	}
+}
+
+func TestNoDiagnostics(t *testing.T) {
+	source := `class Main {
+    function void main() {
+        var Array a;
+        var char c;
+        let a = Array.new(2);
+        let a[0] = null;
+        let c = 65;
+        do Output.printChar(c);
+        do a.dispose();
+        return;
+    }
+}`
+	if diagnostics := check(t, source); len(diagnostics) > 0 {
+		t.Errorf("unexpected diagnostics:\n%v", diagnostics)
+	}
+}
+
+// check parses and checks source as the class Main, and returns the errors
+// and warnings of both
+func check(t *testing.T, source string) ErrorList {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), "Main.jack")
+	if err := os.WriteFile(file, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	class, warnings, err := parse(file, false)
+	if err != nil {
+		errs, ok := err.(ErrorList)
+		if !ok {
+			t.Fatal(err)
+		}
+		return append(warnings, errs...)
+	}
+
+	return append(warnings, NewChecker(file, NewClassTable([]*Class{class})).Check(class)...)
+}
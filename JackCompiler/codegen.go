@@ -0,0 +1,356 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+var binaryCommands map[rune]ArithmeticCommand = map[rune]ArithmeticCommand{
+	'+': ARITHMETIC_COMMAND_ADD,
+	'-': ARITHMETIC_COMMAND_SUB,
+	'&': ARITHMETIC_COMMAND_AND,
+	'|': ARITHMETIC_COMMAND_OR,
+	'<': ARITHMETIC_COMMAND_LT,
+	'>': ARITHMETIC_COMMAND_GT,
+	'=': ARITHMETIC_COMMAND_EQ,
+}
+
+var binaryCalls map[rune]string = map[rune]string{
+	'*': "Math.multiply",
+	'/': "Math.divide",
+}
+
+// CodeGenerator walks the syntax tree of a class and writes its VM code.
+type CodeGenerator struct {
+	file       string
+	errs       ErrorList
+	writer     *VMWriter
+	cst        *SymbolTable
+	sst        *SymbolTable
+	className  string
+	ifCount    int
+	whileCount int
+	optimize   bool
+}
+
+// NewCodeGenerator returns a generator that writes to output. With optimize
+// set it jumps on a negated condition without negating it twice, and leaves
+// out the jump over a missing else branch.
+func NewCodeGenerator(file string, output io.Writer, optimize bool) *CodeGenerator {
+	g := CodeGenerator{
+		file:     file,
+		writer:   NewVMWriter(output),
+		cst:      NewSymbolTable(),
+		sst:      NewSymbolTable(),
+		optimize: optimize,
+	}
+
+	return &g
+}
+
+// Generate writes the code of class. It returns the undefined variables as
+// an ErrorList, otherwise the error of writing the output.
+func (g *CodeGenerator) Generate(class *Class) error {
+	g.cst.Reset()
+	g.className = class.Name
+
+	for _, v := range class.Vars {
+		g.cst.Define(v.Name, symbolType(v.Type), v.Kind)
+	}
+
+	for _, subroutine := range class.Subroutines {
+		g.generateSubroutine(subroutine)
+	}
+
+	if len(g.errs) > 0 {
+		return g.errs
+	}
+
+	return g.writer.Flush()
+}
+
+// Commands returns the number of VM commands written so far.
+func (g *CodeGenerator) Commands() int {
+	return g.writer.Commands()
+}
+
+// the boolean type is recorded as int in the symbol tables
+func symbolType(t Type) string {
+	if t.Name == KEYWORD_BOOLEAN.String() {
+		return KEYWORD_INT.String()
+	}
+	return t.Name
+}
+
+func (g *CodeGenerator) generateSubroutine(subroutine *Subroutine) {
+	g.sst.Reset()
+
+	if subroutine.Kind == KEYWORD_METHOD {
+		g.sst.Define(KEYWORD_THIS.String(), g.className, SYMBOL_ARG)
+	}
+
+	for _, v := range subroutine.Parameters {
+		g.sst.Define(v.Name, symbolType(v.Type), SYMBOL_ARG)
+	}
+
+	for _, v := range subroutine.Locals {
+		g.sst.Define(v.Name, symbolType(v.Type), SYMBOL_VAR)
+	}
+
+	g.writer.WriteFunction(g.className+"."+subroutine.Name, g.sst.VarCount(SYMBOL_VAR))
+
+	if subroutine.Kind == KEYWORD_CONSTRUCTOR {
+		g.writer.WritePush(STACK_SEGMENT_CONSTANT, g.cst.VarCount(SYMBOL_FIELD))
+		g.writer.WriteCall("Memory.alloc", 1)
+		g.writer.WritePop(STACK_SEGMENT_POINTER, 0)
+	}
+
+	if subroutine.Kind == KEYWORD_METHOD {
+		g.writer.WritePush(STACK_SEGMENT_ARGUMENT, 0)
+		g.writer.WritePop(STACK_SEGMENT_POINTER, 0)
+	}
+
+	g.generateStatements(subroutine.Body)
+}
+
+func (g *CodeGenerator) generateStatements(statements []Statement) {
+	for _, statement := range statements {
+		switch s := statement.(type) {
+		case *LetStatement:
+			g.generateLet(s)
+		case *IfStatement:
+			g.generateIf(s)
+		case *WhileStatement:
+			g.generateWhile(s)
+		case *DoStatement:
+			g.generateExpression(s.Call)
+			g.writer.WritePop(STACK_SEGMENT_TEMP, 0)
+		case *ReturnStatement:
+			if s.Value != nil {
+				g.generateExpression(s.Value)
+			}
+			g.writer.WriteReturn()
+		}
+	}
+}
+
+func (g *CodeGenerator) generateLet(let *LetStatement) {
+	kind, index, _ := g.lookupVar(let.Name)
+	if kind == SYMBOL_NONE {
+		g.errorAt(let.NamePosition, "undefined variable '%s'", let.Name)
+		return
+	}
+
+	if let.Index != nil {
+		g.writer.WritePush(symbolKindToStackSegment[kind], index)
+		g.generateExpression(let.Index)
+		g.writer.WriteArithmetic(ARITHMETIC_COMMAND_ADD)
+
+		g.generateExpression(let.Value)
+
+		g.writer.WritePop(STACK_SEGMENT_TEMP, 0)
+		g.writer.WritePop(STACK_SEGMENT_POINTER, 1)
+		g.writer.WritePush(STACK_SEGMENT_TEMP, 0)
+		g.writer.WritePop(STACK_SEGMENT_THAT, 0)
+	} else {
+		g.generateExpression(let.Value)
+		g.writer.WritePop(symbolKindToStackSegment[kind], index)
+	}
+}
+
+func (g *CodeGenerator) generateIf(statement *IfStatement) {
+	labelElse := "ELSE_" + strconv.Itoa(g.ifCount)
+	labelEnd := "IF_END_" + strconv.Itoa(g.ifCount)
+	g.ifCount++
+
+	g.generateNegation(statement.Condition)
+	g.writer.WriteIf(labelElse)
+
+	g.generateStatements(statement.Then)
+
+	// without an else branch there is nothing to jump over
+	if g.optimize && statement.Else == nil {
+		g.writer.WriteLabel(labelElse)
+		return
+	}
+
+	g.writer.WriteGoto(labelEnd)
+	g.writer.WriteLabel(labelElse)
+
+	g.generateStatements(statement.Else)
+
+	g.writer.WriteLabel(labelEnd)
+}
+
+func (g *CodeGenerator) generateWhile(statement *WhileStatement) {
+	labelStart := "WHILE_START_" + strconv.Itoa(g.whileCount)
+	labelEnd := "WHILE_END_" + strconv.Itoa(g.whileCount)
+	g.whileCount++
+
+	g.writer.WriteLabel(labelStart)
+
+	g.generateNegation(statement.Condition)
+	g.writer.WriteIf(labelEnd)
+
+	g.generateStatements(statement.Body)
+
+	g.writer.WriteGoto(labelStart)
+	g.writer.WriteLabel(labelEnd)
+}
+
+// generateNegation writes the code of the negated condition of a jump
+func (g *CodeGenerator) generateNegation(condition Expression) {
+	if not, ok := condition.(*UnaryExpression); ok && g.optimize && not.Operator == '~' {
+		g.generateExpression(not.Operand)
+		return
+	}
+
+	g.generateExpression(condition)
+	g.writer.WriteArithmetic(ARITHMETIC_COMMAND_NOT)
+}
+
+func (g *CodeGenerator) generateExpression(expression Expression) {
+	switch e := expression.(type) {
+	case *IntegerConstant:
+		g.writer.WritePush(STACK_SEGMENT_CONSTANT, e.Value)
+
+	case *StringConstant:
+		g.writer.WritePush(STACK_SEGMENT_CONSTANT, len(e.Value))
+		g.writer.WriteCall("String.new", 1)
+		for _, char := range e.Value {
+			g.writer.WritePush(STACK_SEGMENT_CONSTANT, int(char))
+			g.writer.WriteCall("String.appendChar", 2)
+		}
+
+	case *KeywordConstant:
+		switch e.Keyword {
+		case KEYWORD_TRUE:
+			g.writer.WritePush(STACK_SEGMENT_CONSTANT, 1)
+			g.writer.WriteArithmetic(ARITHMETIC_COMMAND_NEG)
+
+		case KEYWORD_FALSE, KEYWORD_NULL:
+			g.writer.WritePush(STACK_SEGMENT_CONSTANT, 0)
+
+		case KEYWORD_THIS:
+			kind, index, _ := g.lookupVar(KEYWORD_THIS.String())
+			if kind != SYMBOL_NONE {
+				g.writer.WritePush(symbolKindToStackSegment[kind], index)
+			} else {
+				g.writer.WritePush(STACK_SEGMENT_POINTER, 0)
+			}
+		}
+
+	case *VariableExpression:
+		kind, index, _ := g.lookupVar(e.Name)
+		if kind == SYMBOL_NONE {
+			g.errorAt(e.Position, "undefined variable '%s'", e.Name)
+			return
+		}
+		g.writer.WritePush(symbolKindToStackSegment[kind], index)
+
+	case *IndexExpression:
+		kind, index, _ := g.lookupVar(e.Name)
+		if kind == SYMBOL_NONE {
+			g.errorAt(e.Position, "undefined variable '%s'", e.Name)
+			return
+		}
+		g.writer.WritePush(symbolKindToStackSegment[kind], index)
+		g.generateExpression(e.Index)
+		g.writer.WriteArithmetic(ARITHMETIC_COMMAND_ADD)
+		g.writer.WritePop(STACK_SEGMENT_POINTER, 1)
+		g.writer.WritePush(STACK_SEGMENT_THAT, 0)
+
+	case *CallExpression:
+		g.generateCall(e)
+
+	case *UnaryExpression:
+		g.generateExpression(e.Operand)
+		if e.Operator == '-' {
+			g.writer.WriteArithmetic(ARITHMETIC_COMMAND_NEG)
+		} else {
+			g.writer.WriteArithmetic(ARITHMETIC_COMMAND_NOT)
+		}
+
+	case *BinaryExpression:
+		g.generateExpression(e.Left)
+		g.generateExpression(e.Right)
+		if function, ok := binaryCalls[e.Operator]; ok {
+			g.writer.WriteCall(function, 2)
+		} else {
+			g.writer.WriteArithmetic(binaryCommands[e.Operator])
+		}
+
+	case *ShiftExpression:
+		g.generateExpression(e.Operand)
+		for i := 0; i < e.Count; i++ {
+			if e.Right {
+				g.writer.WriteArithmetic(ARITHMETIC_COMMAND_SHR)
+			} else {
+				g.writer.WriteArithmetic(ARITHMETIC_COMMAND_SHL)
+			}
+		}
+
+	case *ParenExpression:
+		g.generateExpression(e.Inner)
+	}
+}
+
+// generateCall writes a call of a function when the receiver is not a
+// variable, otherwise a call of a method that passes the receiver, or the
+// current object without one, as the first argument
+func (g *CodeGenerator) generateCall(call *CallExpression) {
+	object := call.Receiver
+	if object == "" {
+		object = KEYWORD_THIS.String()
+	}
+
+	kind, index, className := g.lookupVar(object)
+
+	switch {
+	case kind != SYMBOL_NONE:
+		g.writer.WritePush(symbolKindToStackSegment[kind], index)
+	case call.Receiver == "":
+		g.writer.WritePush(STACK_SEGMENT_POINTER, 0)
+		className = g.className
+	default:
+		for _, argument := range call.Arguments {
+			g.generateExpression(argument)
+		}
+		g.writer.WriteCall(call.Receiver+"."+call.Name, len(call.Arguments))
+		return
+	}
+
+	for _, argument := range call.Arguments {
+		g.generateExpression(argument)
+	}
+	g.writer.WriteCall(className+"."+call.Name, len(call.Arguments)+1)
+}
+
+func (g *CodeGenerator) lookupVar(v string) (SymbolKind, int, string) {
+	var (
+		kind       SymbolKind
+		index      int
+		symbolType string
+	)
+
+	kind = g.sst.KindOf(v)
+	if kind == SYMBOL_NONE {
+		kind = g.cst.KindOf(v)
+		index = g.cst.IndexOf(v)
+		symbolType = g.cst.TypeOf(v)
+	} else {
+		index = g.sst.IndexOf(v)
+		symbolType = g.sst.TypeOf(v)
+	}
+
+	return kind, index, symbolType
+}
+
+func (g *CodeGenerator) errorAt(position Position, format string, a ...interface{}) {
+	g.errs = append(g.errs, &Error{
+		File:     g.file,
+		Position: position,
+		Message:  fmt.Sprintf(format, a...),
+	})
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// the expected code of the OS is in testdata/OS, next to the programs
+var generateTests = []struct {
+	name     string
+	sources  string
+	expected string
+}{
+	{"Seven", "testdata/Seven", "testdata/Seven"},
+	{"Points", "testdata/Points", "testdata/Points"},
+	{"OS", "../projects/12", "testdata/OS"},
+}
+
+func TestGenerate(t *testing.T) {
+	for _, test := range generateTests {
+		t.Run(test.name, func(t *testing.T) {
+			sources, err := filepath.Glob(filepath.Join(test.sources, "*.jack"))
+			if err != nil || len(sources) == 0 {
+				t.Fatalf("no sources in %s", test.sources)
+			}
+
+			for _, source := range sources {
+				class, _, err := parse(source, false)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var output bytes.Buffer
+				if _, err := generate(source, &output, class, false); err != nil {
+					t.Fatal(err)
+				}
+
+				name := strings.TrimSuffix(filepath.Base(source), ".jack") + ".vm"
+				expected, err := os.ReadFile(filepath.Join(test.expected, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !bytes.Equal(output.Bytes(), expected) {
+					t.Errorf("%s: output differs from %s", source, filepath.Join(test.expected, name))
+				}
+			}
+		})
+	}
+}
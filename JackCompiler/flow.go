@@ -0,0 +1,174 @@
+package main
+
+// flowState is what is known at a point of a subroutine: the local variables
+// that are assigned on every path to it, and whether every path to it has
+// returned, or at least never gets there because of a return or an endless
+// loop
+type flowState struct {
+	assigned map[string]bool
+	returned bool
+	stopped  bool
+}
+
+func (s flowState) copy() flowState {
+	assigned := make(map[string]bool)
+	for name := range s.assigned {
+		assigned[name] = true
+	}
+	return flowState{assigned: assigned, returned: s.returned, stopped: s.stopped}
+}
+
+// merge joins the states at the ends of two branches
+func merge(a, b flowState) flowState {
+	switch {
+	case a.stopped && b.stopped:
+		return flowState{assigned: a.assigned, returned: a.returned && b.returned, stopped: true}
+	case a.stopped:
+		return b
+	case b.stopped:
+		return a
+	}
+
+	assigned := make(map[string]bool)
+	for name := range a.assigned {
+		if b.assigned[name] {
+			assigned[name] = true
+		}
+	}
+	return flowState{assigned: assigned}
+}
+
+// checkFlow follows the control flow of a subroutine. A subroutine must not
+// fall off its end, since its code would run into the next one. Statements
+// after a return, locals that may be read before they are assigned, and
+// variables that are never read are warned about.
+func (c *Checker) checkFlow(subroutine *Subroutine) {
+	c.read = make(map[string]bool)
+	c.written = make(map[string]bool)
+	c.uninitialized = make(map[string]bool)
+
+	state := c.flowStatements(subroutine.Body, flowState{assigned: make(map[string]bool)})
+	if !state.stopped {
+		c.errorAt(subroutine.End, "missing return at the end of %s.%s", c.class.Name, subroutine.Name)
+	}
+
+	for _, v := range subroutine.Parameters {
+		if !c.read[v.Name] {
+			c.warnAt(v.Position, "parameter '%s' is never used", v.Name)
+		}
+	}
+
+	for _, v := range subroutine.Locals {
+		switch {
+		case c.read[v.Name]:
+		case c.written[v.Name]:
+			c.warnAt(v.Position, "local variable '%s' is assigned but never used", v.Name)
+		default:
+			c.warnAt(v.Position, "local variable '%s' is never used", v.Name)
+		}
+	}
+}
+
+func (c *Checker) flowStatements(statements []Statement, state flowState) flowState {
+	unreachable := false
+
+	for _, statement := range statements {
+		if state.returned && !unreachable {
+			c.warnAt(statement.Pos(), "unreachable statement after return")
+			unreachable = true
+		}
+
+		switch s := statement.(type) {
+		case *LetStatement:
+			if s.Index != nil {
+				c.flowRead(s.Name, s.NamePosition, state)
+				c.flowExpression(s.Index, state)
+				c.flowExpression(s.Value, state)
+				continue
+			}
+			c.flowExpression(s.Value, state)
+			if v := c.localVars[s.Name]; v != nil && v.Kind == SYMBOL_VAR {
+				state.assigned[s.Name] = true
+				c.written[s.Name] = true
+			}
+
+		case *IfStatement:
+			c.flowExpression(s.Condition, state)
+			state = merge(c.flowStatements(s.Then, state.copy()), c.flowStatements(s.Else, state.copy()))
+
+		case *WhileStatement:
+			c.flowExpression(s.Condition, state)
+			c.flowStatements(s.Body, state.copy())
+			if isTrue(s.Condition) {
+				state.stopped = true
+			}
+
+		case *DoStatement:
+			c.flowExpression(s.Call, state)
+
+		case *ReturnStatement:
+			if s.Value != nil {
+				c.flowExpression(s.Value, state)
+			}
+			state.returned = true
+			state.stopped = true
+		}
+	}
+
+	return state
+}
+
+// isTrue reports whether e is the constant true, which makes a while loop
+// endless since Jack has no break
+func isTrue(e Expression) bool {
+	for paren, ok := e.(*ParenExpression); ok; paren, ok = e.(*ParenExpression) {
+		e = paren.Inner
+	}
+	constant, ok := e.(*KeywordConstant)
+	return ok && constant.Keyword == KEYWORD_TRUE
+}
+
+func (c *Checker) flowExpression(expression Expression, state flowState) {
+	switch e := expression.(type) {
+	case *VariableExpression:
+		c.flowRead(e.Name, e.Position, state)
+
+	case *IndexExpression:
+		c.flowRead(e.Name, e.Position, state)
+		c.flowExpression(e.Index, state)
+
+	case *CallExpression:
+		if e.Receiver != "" {
+			c.flowRead(e.Receiver, e.Position, state)
+		}
+		for _, argument := range e.Arguments {
+			c.flowExpression(argument, state)
+		}
+
+	case *UnaryExpression:
+		c.flowExpression(e.Operand, state)
+
+	case *BinaryExpression:
+		c.flowExpression(e.Left, state)
+		c.flowExpression(e.Right, state)
+
+	case *ParenExpression:
+		c.flowExpression(e.Inner, state)
+	}
+}
+
+// flowRead records a read of name if it is a parameter or local variable,
+// and warns once about a local variable that is not assigned on every path
+// to the read
+func (c *Checker) flowRead(name string, position Position, state flowState) {
+	v := c.localVars[name]
+	if v == nil {
+		return
+	}
+	c.read[name] = true
+
+	if v.Kind == SYMBOL_VAR && !state.assigned[name] && !c.uninitialized[name] {
+		c.uninitialized[name] = true
+		c.warnAt(position, "local variable '%s' may be read before it is assigned", name)
+	}
+}
@@ -2,4 +2,9 @@ module github.com/pcjun97/nand2tetris/JackCompiler
 
 go 1.19
 
-require github.com/pkg/errors v0.9.1
+require (
+	github.com/pcjun97/JackVMTranslator v0.0.0
+	github.com/pkg/errors v0.9.1
+)
+
+replace github.com/pcjun97/JackVMTranslator => ../VMTranslator
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"io"
 	"log"
 	"os"
 	"path"
@@ -8,54 +11,203 @@ import (
 )
 
 func main() {
-	if len(os.Args) != 2 {
-		log.Fatalln("usage: JackCompiler source")
+	optimize := flag.Bool("O", false, "fold constants and simplify expressions")
+	stats := flag.Bool("stats", false, "print the number of VM commands of every class")
+	extended := flag.Bool("ext", false, "with -O, multiply and divide by 2 and 4 with the shl and shr of the extended instruction set of the VM translator")
+	precedence := flag.Bool("precedence", false, "give binary operators conventional precedence instead of evaluating them from left to right")
+
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: JackCompiler [options] source")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if *extended && !*optimize {
+		log.Fatalln("-ext requires -O")
 	}
 
-	inputPath := os.Args[1]
+	inputPath := flag.Arg(0)
 
 	pathInfo, err := os.Stat(inputPath)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	var paths []string
+	var paths, siblings []string
 
 	if pathInfo.IsDir() {
-		files, err := os.ReadDir(inputPath)
+		paths, err = jackFiles(inputPath)
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		for _, file := range files {
-			if strings.HasSuffix(file.Name(), ".jack") {
-				paths = append(paths, path.Join(inputPath, file.Name()))
-			}
-		}
-
 	} else {
 		if !strings.HasSuffix(inputPath, ".jack") {
 			log.Fatalln("invalid file type")
 		}
 
 		paths = append(paths, inputPath)
+
+		others, err := jackFiles(path.Dir(inputPath))
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, other := range others {
+			if path.Base(other) != path.Base(inputPath) {
+				siblings = append(siblings, other)
+			}
+		}
 	}
 
+	failed := false
+
+	var files []string
+	var classes, declarations []*Class
+	var warnings []ErrorList
+
 	for _, inputFilePath := range paths {
-		inputFile, err := os.Open(inputFilePath)
+		class, parseWarnings, err := parse(inputFilePath, *precedence)
 		if err != nil {
-			panic(err)
+			fmt.Fprintln(os.Stderr, err)
+			failed = true
+			continue
 		}
-		defer inputFile.Close()
+		files = append(files, inputFilePath)
+		classes = append(classes, class)
+		warnings = append(warnings, parseWarnings)
+	}
+
+	// the other classes next to a single source file are only read for
+	// their declarations, and are not compiled
+	for _, sibling := range siblings {
+		if class, _, err := parse(sibling, *precedence); err == nil {
+			declarations = append(declarations, class)
+		}
+	}
+
+	// every class is checked before any is written, so that a program with
+	// errors leaves no partial output behind
+	table := NewClassTable(append(declarations, classes...))
+
+	for i, class := range classes {
+		diagnostics := append(warnings[i], NewChecker(files[i], table).Check(class)...)
+		diagnostics.Sort()
+		if len(diagnostics) > 0 {
+			fmt.Fprintln(os.Stderr, diagnostics)
+		}
+		if diagnostics.Failed() {
+			failed = true
+		}
+	}
 
-		outputFilePath := strings.TrimSuffix(inputFilePath, ".jack") + ".vm"
-		outputFile, err := os.Create(outputFilePath)
+	if failed {
+		os.Exit(1)
+	}
+
+	total, totalBefore := 0, 0
+
+	for i, class := range classes {
+		before := 0
+		if *optimize {
+			if *stats {
+				before, _ = generate(files[i], io.Discard, class, false)
+			}
+			Optimize(class, *extended)
+		}
+
+		commands, err := compile(files[i], class, *optimize)
 		if err != nil {
-			panic(err)
+			fmt.Fprintln(os.Stderr, err)
+			failed = true
+			continue
+		}
+
+		if *stats {
+			fmt.Fprintln(os.Stderr, commandStats(files[i], commands, before))
 		}
-		defer outputFile.Close()
+		total += commands
+		totalBefore += before
+	}
+
+	if *stats && len(classes) > 1 {
+		fmt.Fprintln(os.Stderr, commandStats("total", total, totalBefore))
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func jackFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".jack") {
+			paths = append(paths, path.Join(dir, entry.Name()))
+		}
+	}
+
+	return paths, nil
+}
+
+// parse parses a .jack file and returns its class along with the warnings
+// of the parser
+func parse(inputFilePath string, precedence bool) (*Class, ErrorList, error) {
+	inputFile, err := os.Open(inputFilePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer inputFile.Close()
+
+	p := NewParser(inputFile, precedence)
+	class, err := p.ParseClass()
+	return class, p.Warnings(), err
+}
+
+// compile writes the code of class into a .vm file next to its source, which
+// is removed again if the class does not compile, and returns the number of
+// commands written
+func compile(inputFilePath string, class *Class, optimize bool) (int, error) {
+	outputFilePath := strings.TrimSuffix(inputFilePath, ".jack") + ".vm"
+	outputFile, err := os.Create(outputFilePath)
+	if err != nil {
+		return 0, err
+	}
+
+	commands, err := generate(inputFilePath, outputFile, class, optimize)
+
+	if closeErr := outputFile.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(outputFilePath)
+	}
+
+	return commands, err
+}
+
+func generate(inputFilePath string, output io.Writer, class *Class, optimize bool) (int, error) {
+	g := NewCodeGenerator(inputFilePath, output, optimize)
+	err := g.Generate(class)
+	return g.Commands(), err
+}
 
-		c := NewCompilationEngine(inputFile, outputFile)
-		c.CompileClass()
+// commandStats describes the number of commands of a class, and how many the
+// optimizer saved if it was measured before
+func commandStats(name string, commands, before int) string {
+	if before == 0 {
+		return fmt.Sprintf("%s: %d VM commands", name, commands)
 	}
+	return fmt.Sprintf("%s: %d VM commands, %d without -O (%+.1f%%)",
+		name, commands, before, 100*float64(commands-before)/float64(before))
 }
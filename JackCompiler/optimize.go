@@ -0,0 +1,420 @@
+package main
+
+// Optimize rewrites the expressions of class into ones that compile to fewer
+// or cheaper VM commands. It folds constant subexpressions in the 16-bit
+// arithmetic of the Hack computer, drops operations that do nothing,
+// replaces a multiplication of a variable or constant by 2 with an addition,
+// and negates comparisons with a constant by flipping them. An operand that
+// is dropped because the result does not depend on it must not call a
+// subroutine.
+//
+// Other multiplications by powers of two stay calls of Math.multiply, since
+// doubling a value takes more commands than the call. The VM has no shift,
+// and no sequence of its other commands moves a bit to a lower one, so a
+// division by a power of two other than 1 stays a call of Math.divide.
+//
+// If extended is set, multiplications and divisions by 2 and 4 become the
+// shl and shr of the extended instruction set of the VM translator, which
+// round towards zero like Math.divide.
+func Optimize(class *Class, extended bool) {
+	for _, subroutine := range class.Subroutines {
+		optimizeStatements(subroutine.Body, extended)
+	}
+}
+
+func optimizeStatements(statements []Statement, extended bool) {
+	for _, statement := range statements {
+		switch s := statement.(type) {
+		case *LetStatement:
+			if s.Index != nil {
+				s.Index = optimizeExpression(s.Index, extended)
+			}
+			s.Value = optimizeExpression(s.Value, extended)
+
+		case *IfStatement:
+			s.Condition = optimizeExpression(s.Condition, extended)
+			optimizeStatements(s.Then, extended)
+			optimizeStatements(s.Else, extended)
+
+		case *WhileStatement:
+			s.Condition = optimizeExpression(s.Condition, extended)
+			optimizeStatements(s.Body, extended)
+
+		case *DoStatement:
+			optimizeArguments(s.Call, extended)
+
+		case *ReturnStatement:
+			if s.Value != nil {
+				s.Value = optimizeExpression(s.Value, extended)
+			}
+		}
+	}
+}
+
+func optimizeArguments(call *CallExpression, extended bool) {
+	for i, argument := range call.Arguments {
+		call.Arguments[i] = optimizeExpression(argument, extended)
+	}
+}
+
+func optimizeExpression(expression Expression, extended bool) Expression {
+	switch e := expression.(type) {
+	case *IndexExpression:
+		e.Index = optimizeExpression(e.Index, extended)
+
+	case *CallExpression:
+		optimizeArguments(e, extended)
+
+	case *ParenExpression:
+		return optimizeExpression(e.Inner, extended)
+
+	case *UnaryExpression:
+		e.Operand = optimizeExpression(e.Operand, extended)
+		return optimizeUnary(e)
+
+	case *BinaryExpression:
+		e.Left = optimizeExpression(e.Left, extended)
+		e.Right = optimizeExpression(e.Right, extended)
+		return optimizeBinary(e, extended)
+	}
+
+	return expression
+}
+
+func optimizeUnary(e *UnaryExpression) Expression {
+	if value, ok := constantValue(e.Operand); ok {
+		if e.Operator == '-' {
+			return constantExpression(e.Position, -value)
+		}
+		return constantExpression(e.Position, ^value)
+	}
+
+	if inner, ok := e.Operand.(*UnaryExpression); ok && inner.Operator == e.Operator {
+		return inner.Operand
+	}
+
+	if e.Operator == '~' {
+		if flipped := flipComparison(e.Operand); flipped != nil {
+			return flipped
+		}
+	}
+
+	return e
+}
+
+// flipComparison returns the negation of a < or > comparison with a
+// constant as the opposite comparison, or nil if there is none: ~(x < c) is
+// x > c-1, ~(x > c) is x < c+1, ~(c < x) is c+1 > x and ~(c > x) is c-1 < x
+func flipComparison(e Expression) Expression {
+	comparison, ok := e.(*BinaryExpression)
+	if !ok || comparison.Operator != '<' && comparison.Operator != '>' {
+		return nil
+	}
+
+	flipped := BinaryExpression{comparison.Node, '<' + '>' - comparison.Operator, comparison.Left, comparison.Right}
+
+	step := int16(1)
+	if comparison.Operator == '<' {
+		step = -1
+	}
+
+	if c, ok := constantValue(comparison.Right); ok {
+		if c == -32768 && step < 0 || c == 32767 && step > 0 {
+			return nil
+		}
+		flipped.Right = constantExpression(comparison.Right.Pos(), c+step)
+		return &flipped
+	}
+
+	if c, ok := constantValue(comparison.Left); ok {
+		if c == 32767 && step < 0 || c == -32768 && step > 0 {
+			return nil
+		}
+		flipped.Left = constantExpression(comparison.Left.Pos(), c-step)
+		return &flipped
+	}
+
+	return nil
+}
+
+func optimizeBinary(e *BinaryExpression, extended bool) Expression {
+	left, leftConstant := constantValue(e.Left)
+	right, rightConstant := constantValue(e.Right)
+
+	if leftConstant && rightConstant {
+		if value, ok := fold(e.Operator, left, right); ok {
+			return constantExpression(e.Position, value)
+		}
+		return e
+	}
+
+	switch e.Operator {
+	case '+', '-':
+		if rightConstant {
+			base, offset := splitOffset(e.Left)
+			if e.Operator == '+' {
+				return withOffset(e.Position, base, offset+right)
+			}
+			return withOffset(e.Position, base, offset-right)
+		}
+		if leftConstant && left == 0 {
+			if e.Operator == '+' {
+				return e.Right
+			}
+			return optimizeUnary(&UnaryExpression{e.Node, '-', e.Right})
+		}
+		if leftConstant && e.Operator == '+' {
+			return withOffset(e.Position, e.Right, left)
+		}
+
+	case '*':
+		if leftConstant {
+			return multiply(e, e.Right, left, extended)
+		}
+		if rightConstant {
+			return multiply(e, e.Left, right, extended)
+		}
+
+	case '/':
+		if rightConstant && right == 1 {
+			return e.Left
+		}
+		if rightConstant && right == -1 {
+			return optimizeUnary(&UnaryExpression{e.Node, '-', e.Left})
+		}
+		if rightConstant && extended {
+			return shift(e, e.Left, right, true)
+		}
+
+	case '&', '|':
+		// x & -1 and x | 0 are x, x & 0 is 0 and x | -1 is -1
+		identity, absorbing := int16(-1), int16(0)
+		if e.Operator == '|' {
+			identity, absorbing = 0, -1
+		}
+		operand, constant := e.Left, right
+		if leftConstant {
+			operand, constant = e.Right, left
+		}
+		if leftConstant || rightConstant {
+			if constant == identity {
+				return operand
+			}
+			if constant == absorbing && isPure(operand) {
+				return constantExpression(e.Position, absorbing)
+			}
+		}
+
+	case '=':
+		// a comparison is -1 or 0, so comparing it with true or false is
+		// the comparison itself or its negation
+		operand, constant := e.Left, right
+		if leftConstant {
+			operand, constant = e.Right, left
+		}
+		if (leftConstant || rightConstant) && isBoolean(operand) {
+			if constant == -1 {
+				return operand
+			}
+			if constant == 0 {
+				return optimizeUnary(&UnaryExpression{e.Node, '~', operand})
+			}
+		}
+	}
+
+	return e
+}
+
+// multiply optimizes a multiplication of operand by a constant. Pushing a
+// variable twice and adding takes as many commands as the call, and leaves
+// out the multiplication itself.
+func multiply(e *BinaryExpression, operand Expression, constant int16, extended bool) Expression {
+	switch {
+	case extended && constant > 1:
+		return shift(e, operand, constant, false)
+	case constant == 0 && isPure(operand):
+		return constantExpression(e.Position, 0)
+	case constant == 1:
+		return operand
+	case constant == -1:
+		return optimizeUnary(&UnaryExpression{e.Node, '-', operand})
+	case constant == 2 && isSimple(operand):
+		return &BinaryExpression{e.Node, '+', operand, operand}
+	}
+	return e
+}
+
+// shift replaces e, the multiplication or division of operand by constant,
+// with shifts if constant is 2 or 4, since shifting twice takes as many
+// commands as the call
+func shift(e *BinaryExpression, operand Expression, constant int16, right bool) Expression {
+	count := 0
+	for constant > 1 && constant%2 == 0 {
+		constant /= 2
+		count++
+	}
+	if constant != 1 || count > 2 {
+		return e
+	}
+
+	if inner, ok := operand.(*ShiftExpression); ok && inner.Right == right {
+		inner.Count += count
+		return inner
+	}
+	return &ShiftExpression{e.Node, operand, count, right}
+}
+
+// splitOffset splits e into x and c if it is x + c or x - c with a constant
+// c, so that constants added in a row can be added up
+func splitOffset(e Expression) (Expression, int16) {
+	if b, ok := e.(*BinaryExpression); ok && (b.Operator == '+' || b.Operator == '-') {
+		if c, ok := constantValue(b.Right); ok {
+			if b.Operator == '-' {
+				return b.Left, -c
+			}
+			return b.Left, c
+		}
+	}
+	return e, 0
+}
+
+// withOffset returns e + offset, subtracting a negative offset instead of
+// adding its negation
+func withOffset(position Position, e Expression, offset int16) Expression {
+	node := Node{position}
+	switch {
+	case offset == 0:
+		return e
+	case offset < 0 && offset != -32768:
+		return &BinaryExpression{node, '-', e, constantExpression(position, -offset)}
+	}
+	return &BinaryExpression{node, '+', e, constantExpression(position, offset)}
+}
+
+// fold computes a binary operation on constants like the VM does, and fails
+// on a division by zero, which is left to Math.divide to report
+func fold(operator rune, left, right int16) (int16, bool) {
+	switch operator {
+	case '+':
+		return left + right, true
+	case '-':
+		return left - right, true
+	case '*':
+		return left * right, true
+	case '/':
+		if right == 0 {
+			return 0, false
+		}
+		return left / right, true
+	case '&':
+		return left & right, true
+	case '|':
+		return left | right, true
+	case '<':
+		return truth(left < right), true
+	case '>':
+		return truth(left > right), true
+	case '=':
+		return truth(left == right), true
+	}
+	return 0, false
+}
+
+func truth(b bool) int16 {
+	if b {
+		return -1
+	}
+	return 0
+}
+
+// constantValue returns the value of e if it is a constant: an integer
+// constant, true, false, null, or a constant made by constantExpression
+func constantValue(e Expression) (int16, bool) {
+	switch e := e.(type) {
+	case *IntegerConstant:
+		return int16(e.Value), true
+
+	case *KeywordConstant:
+		switch e.Keyword {
+		case KEYWORD_TRUE:
+			return -1, true
+		case KEYWORD_FALSE, KEYWORD_NULL:
+			return 0, true
+		}
+
+	case *UnaryExpression:
+		if value, ok := constantValue(e.Operand); ok {
+			if e.Operator == '-' {
+				return -value, true
+			}
+			return ^value, true
+		}
+
+	case *ParenExpression:
+		return constantValue(e.Inner)
+	}
+
+	return 0, false
+}
+
+// constantExpression returns the shortest expression for value; -32768 is
+// ~32767, since 32768 is not an integer constant
+func constantExpression(position Position, value int16) Expression {
+	node := Node{position}
+	switch {
+	case value == -32768:
+		return &UnaryExpression{node, '~', &IntegerConstant{node, 32767}}
+	case value < 0:
+		return &UnaryExpression{node, '-', &IntegerConstant{node, int(-value)}}
+	}
+	return &IntegerConstant{node, int(value)}
+}
+
+// isBoolean reports whether e can only be -1 or 0
+func isBoolean(e Expression) bool {
+	switch e := e.(type) {
+	case *BinaryExpression:
+		switch e.Operator {
+		case '<', '>', '=':
+			return true
+		case '&', '|':
+			return isBoolean(e.Left) && isBoolean(e.Right)
+		}
+	case *UnaryExpression:
+		return e.Operator == '~' && isBoolean(e.Operand)
+	case *KeywordConstant:
+		return e.Keyword == KEYWORD_TRUE || e.Keyword == KEYWORD_FALSE
+	}
+	return false
+}
+
+// isSimple reports whether e is pushed with a single command
+func isSimple(e Expression) bool {
+	switch e := e.(type) {
+	case *VariableExpression, *IntegerConstant:
+		return true
+	case *KeywordConstant:
+		return e.Keyword != KEYWORD_TRUE
+	}
+	return false
+}
+
+// isPure reports whether e calls no subroutine, so that leaving it out does
+// not change what the program does
+func isPure(expression Expression) bool {
+	switch e := expression.(type) {
+	case *CallExpression, *StringConstant:
+		return false
+	case *IndexExpression:
+		return isPure(e.Index)
+	case *UnaryExpression:
+		return isPure(e.Operand)
+	case *ShiftExpression:
+		return isPure(e.Operand)
+	case *BinaryExpression:
+		return isPure(e.Left) && isPure(e.Right) && e.Operator != '*' && e.Operator != '/'
+	case *ParenExpression:
+		return isPure(e.Inner)
+	}
+	return true
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pcjun97/JackVMTranslator/parser"
+	"github.com/pcjun97/JackVMTranslator/vm"
+	"github.com/pcjun97/JackVMTranslator/vm/jackos"
+)
+
+const maxSteps = 10000000
+
+// the Jack OS of projects/12 is compiled along with the program when jackOS
+// is set, except for Sys, whose halt never returns; the built-in Sys calls
+// the init functions of the other classes. Its Math.divide does not return
+// for -32768, which Expressions divides.
+var optimizeTests = []struct {
+	name   string
+	dir    string
+	jackOS bool
+}{
+	{"Expressions", "testdata/Expressions", false},
+	{"Points", "testdata/Points", false},
+	{"Jack OS", "testdata/Points", true},
+}
+
+// TestOptimizeSameResult runs every program compiled without -O, with -O
+// and with -O -ext on the VM, and compares what they print and the memory
+// from the heap on
+func TestOptimizeSameResult(t *testing.T) {
+	for _, test := range optimizeTests {
+		t.Run(test.name, func(t *testing.T) {
+			sources := jackSources(t, test.dir)
+			if test.jackOS {
+				for _, source := range jackSources(t, "../projects/12") {
+					if filepath.Base(source) != "Sys.jack" {
+						sources = append(sources, source)
+					}
+				}
+			}
+
+			files, commands := compileProgram(t, sources, false, false)
+			output, heap := run(t, files)
+
+			for _, extended := range []bool{false, true} {
+				optimized, optimizedCommands := compileProgram(t, sources, true, extended)
+				if optimizedCommands >= commands {
+					t.Errorf("ext %t: %d commands, %d without -O", extended, optimizedCommands, commands)
+				}
+
+				optimizedOutput, optimizedHeap := run(t, optimized)
+				if optimizedOutput != output {
+					t.Errorf("ext %t: output\n%s\nwithout -O\n%s", extended, optimizedOutput, output)
+				}
+				for i := range heap {
+					if optimizedHeap[i] != heap[i] {
+						t.Errorf("ext %t: RAM[%d] = %d, %d without -O", extended, 2048+i, optimizedHeap[i], heap[i])
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestShift(t *testing.T) {
+	sources := jackSources(t, "testdata/Expressions")
+
+	for _, extended := range []bool{false, true} {
+		files, _ := compileProgram(t, sources, true, extended)
+
+		shifts := 0
+		for _, command := range files[0].Commands {
+			if command.Type == parser.C_ARITHMETIC && (command.Arg1 == "shl" || command.Arg1 == "shr") {
+				shifts++
+			}
+		}
+
+		if extended && shifts == 0 {
+			t.Errorf("no shifts with -ext")
+		}
+		if !extended && shifts > 0 {
+			t.Errorf("%d shifts without -ext", shifts)
+		}
+	}
+}
+
+func jackSources(t *testing.T, dir string) []string {
+	t.Helper()
+
+	sources, err := filepath.Glob(filepath.Join(dir, "*.jack"))
+	if err != nil || len(sources) == 0 {
+		t.Fatalf("no sources in %s", dir)
+	}
+	return sources
+}
+
+// compileProgram compiles the sources the way main does, and returns their
+// parsed VM code and its number of commands
+func compileProgram(t *testing.T, sources []string, optimize, extended bool) ([]parser.File, int) {
+	t.Helper()
+
+	var files []parser.File
+	total := 0
+
+	for _, source := range sources {
+		class, _, err := parse(source, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if optimize {
+			Optimize(class, extended)
+		}
+
+		var output bytes.Buffer
+		n, err := generate(source, &output, class, optimize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		total += n
+
+		commands, err := parser.Parse(&output, extended)
+		if err != nil {
+			t.Fatalf("%s: %v", source, err)
+		}
+		files = append(files, parser.File{Name: strings.TrimSuffix(filepath.Base(source), ".jack"), Commands: commands})
+	}
+
+	return files, total
+}
+
+// run runs a program with the built-in OS until it halts, and returns what
+// it printed and the memory from the heap on
+func run(t *testing.T, files []parser.File) (string, []int16) {
+	t.Helper()
+
+	var output strings.Builder
+	files, natives, err := jackos.New(strings.NewReader(""), &output).Install(files, jackos.Classes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := vm.Load(files, natives)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for steps := 0; !m.Halted; steps++ {
+		if steps == maxSteps {
+			t.Fatalf("no halt after %d steps", maxSteps)
+		}
+		if err := m.Step(); err != nil && !errors.Is(err, vm.ErrHalted) {
+			t.Fatal(err)
+		}
+	}
+
+	return output.String(), m.RAM[2048:]
+}
@@ -0,0 +1,675 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// bailout is the panic value that unwinds the parser after an error to the
+// declaration or statement it recovers at
+type bailout struct{}
+
+// the points to skip to after an error
+const (
+	syncStatement = iota
+	syncDeclaration
+)
+
+var statementKeywords map[KeyWord]bool = map[KeyWord]bool{
+	KEYWORD_VAR:    true,
+	KEYWORD_LET:    true,
+	KEYWORD_IF:     true,
+	KEYWORD_WHILE:  true,
+	KEYWORD_DO:     true,
+	KEYWORD_RETURN: true,
+}
+
+var declarationKeywords map[KeyWord]bool = map[KeyWord]bool{
+	KEYWORD_STATIC:      true,
+	KEYWORD_FIELD:       true,
+	KEYWORD_CONSTRUCTOR: true,
+	KEYWORD_FUNCTION:    true,
+	KEYWORD_METHOD:      true,
+}
+
+// the binding strength of the binary operators with conventional precedence
+var operatorLevels map[rune]int = map[rune]int{
+	'|': 1,
+	'&': 2,
+	'<': 3,
+	'>': 3,
+	'=': 3,
+	'+': 4,
+	'-': 4,
+	'*': 5,
+	'/': 5,
+}
+
+type Parser struct {
+	file       string
+	errs       ErrorList
+	warnings   ErrorList
+	tokenizer  *Tokenizer
+	precedence bool
+}
+
+// NewParser returns a parser of input. With precedence set it parses binary
+// operators with conventional precedence instead of from left to right as
+// the Jack language specifies.
+func NewParser(input *os.File, precedence bool) *Parser {
+	tokenizer := NewTokenizer(input)
+	tokenizer.Advance()
+
+	p := Parser{
+		file:       input.Name(),
+		tokenizer:  tokenizer,
+		precedence: precedence,
+	}
+
+	return &p
+}
+
+// Warnings returns the expressions that would be evaluated differently with
+// conventional precedence, found while parsing from left to right.
+func (p *Parser) Warnings() ErrorList {
+	return p.warnings
+}
+
+// ParseClass parses the class of the input file. After a syntax error the
+// parser skips to the next declaration or statement and goes on, so that it
+// returns all errors of the file as an ErrorList.
+func (p *Parser) ParseClass() (*Class, error) {
+	class := Class{Node: Node{p.tokenizer.Position()}}
+
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				if _, ok := r.(bailout); !ok {
+					panic(r)
+				}
+			}
+		}()
+
+		p.processKeyword("class")
+		class.Name = p.processIdentifier()
+		p.processSymbol('{')
+
+		for p.tokenizer.TokenType() != TOKEN_TYPE_EOF && p.tokenizer.Symbol() != '}' {
+			switch p.tokenizer.KeyWord() {
+			case KEYWORD_STATIC, KEYWORD_FIELD:
+				p.recoverAt(syncDeclaration, func() {
+					class.Vars = append(class.Vars, p.parseClassVarDec()...)
+				})
+			case KEYWORD_CONSTRUCTOR, KEYWORD_FUNCTION, KEYWORD_METHOD:
+				p.recoverAt(syncDeclaration, func() {
+					class.Subroutines = append(class.Subroutines, p.parseSubroutine())
+				})
+			default:
+				p.recoverAt(syncDeclaration, func() {
+					p.expected("class variable or subroutine declaration")
+				})
+			}
+		}
+
+		p.processSymbol('}')
+
+		if p.tokenizer.TokenType() != TOKEN_TYPE_EOF {
+			p.expected("end of file")
+		}
+	}()
+
+	if len(p.errs) > 0 {
+		return &class, p.errs
+	}
+
+	return &class, nil
+}
+
+func (p *Parser) parseClassVarDec() []*Var {
+	var kind SymbolKind
+
+	switch p.tokenizer.KeyWord() {
+	case KEYWORD_STATIC:
+		kind = SYMBOL_STATIC
+		p.processKeyword("static")
+	case KEYWORD_FIELD:
+		kind = SYMBOL_FIELD
+		p.processKeyword("field")
+	default:
+		p.expected("'static' or 'field'")
+	}
+
+	return p.parseVarNames(kind, p.processType())
+}
+
+func (p *Parser) parseSubroutine() *Subroutine {
+	subroutine := Subroutine{Node: Node{p.tokenizer.Position()}}
+
+	keyword := p.tokenizer.KeyWord()
+
+	switch keyword {
+	case KEYWORD_CONSTRUCTOR, KEYWORD_FUNCTION, KEYWORD_METHOD:
+		p.processKeyword("")
+		subroutine.Kind = keyword
+
+	default:
+		p.expected("'constructor', 'function' or 'method'")
+	}
+
+	subroutine.ReturnType = p.processReturnType()
+	subroutine.Name = p.processIdentifier()
+
+	p.processSymbol('(')
+	subroutine.Parameters = p.parseParameterList()
+	p.processSymbol(')')
+
+	p.processSymbol('{')
+
+	for p.tokenizer.KeyWord() == KEYWORD_VAR {
+		p.recoverAt(syncStatement, func() {
+			subroutine.Locals = append(subroutine.Locals, p.parseVarDec()...)
+		})
+	}
+
+	subroutine.Body = p.parseStatements()
+	subroutine.End = p.tokenizer.Position()
+	p.processSymbol('}')
+
+	return &subroutine
+}
+
+func (p *Parser) parseParameterList() []*Var {
+	var parameters []*Var
+
+	for p.tokenizer.TokenType() != TOKEN_TYPE_SYMBOL {
+		argType := p.processType()
+		position := p.tokenizer.Position()
+		argName := p.processIdentifier()
+		parameters = append(parameters, &Var{Node{position}, SYMBOL_ARG, argType, argName})
+
+		if p.tokenizer.Symbol() != ',' {
+			break
+		}
+
+		p.processSymbol(',')
+	}
+
+	return parameters
+}
+
+func (p *Parser) parseVarDec() []*Var {
+	p.processKeyword("var")
+	return p.parseVarNames(SYMBOL_VAR, p.processType())
+}
+
+// parseVarNames parses the names of a declaration up to the closing ';'
+func (p *Parser) parseVarNames(kind SymbolKind, varType Type) []*Var {
+	var vars []*Var
+
+	for {
+		position := p.tokenizer.Position()
+		varName := p.processIdentifier()
+		vars = append(vars, &Var{Node{position}, kind, varType, varName})
+
+		if p.tokenizer.Symbol() == ';' {
+			break
+		}
+
+		if p.tokenizer.Symbol() != ',' {
+			p.expected("',' or ';'")
+		}
+		p.processSymbol(',')
+	}
+
+	p.processSymbol(';')
+
+	return vars
+}
+
+func (p *Parser) parseStatements() []Statement {
+	var statements []Statement
+
+	for p.tokenizer.TokenType() != TOKEN_TYPE_EOF && p.tokenizer.Symbol() != '}' {
+		var parse func() Statement
+
+		switch p.tokenizer.KeyWord() {
+		case KEYWORD_LET:
+			parse = p.parseLet
+		case KEYWORD_IF:
+			parse = p.parseIf
+		case KEYWORD_WHILE:
+			parse = p.parseWhile
+		case KEYWORD_DO:
+			parse = p.parseDo
+		case KEYWORD_RETURN:
+			parse = p.parseReturn
+		default:
+			parse = func() Statement {
+				p.expected("statement")
+				return nil
+			}
+		}
+
+		p.recoverAt(syncStatement, func() {
+			statements = append(statements, parse())
+		})
+	}
+
+	return statements
+}
+
+func (p *Parser) parseLet() Statement {
+	let := LetStatement{Node: Node{p.tokenizer.Position()}}
+
+	p.processKeyword("let")
+	let.NamePosition = p.tokenizer.Position()
+	let.Name = p.processIdentifier()
+
+	if p.tokenizer.Symbol() == '[' {
+		p.processSymbol('[')
+		let.Index = p.parseExpression()
+		p.processSymbol(']')
+	}
+
+	p.processSymbol('=')
+	let.Value = p.parseExpression()
+	p.processSymbol(';')
+
+	return &let
+}
+
+func (p *Parser) parseIf() Statement {
+	statement := IfStatement{Node: Node{p.tokenizer.Position()}}
+
+	p.processKeyword("if")
+	p.processSymbol('(')
+	statement.Condition = p.parseExpression()
+	p.processSymbol(')')
+
+	statement.Then = p.parseBlock()
+
+	if p.tokenizer.KeyWord() == KEYWORD_ELSE {
+		p.processKeyword("else")
+		statement.Else = p.parseBlock()
+		if statement.Else == nil {
+			statement.Else = []Statement{}
+		}
+	}
+
+	return &statement
+}
+
+func (p *Parser) parseWhile() Statement {
+	statement := WhileStatement{Node: Node{p.tokenizer.Position()}}
+
+	p.processKeyword("while")
+	p.processSymbol('(')
+	statement.Condition = p.parseExpression()
+	p.processSymbol(')')
+
+	statement.Body = p.parseBlock()
+
+	return &statement
+}
+
+func (p *Parser) parseBlock() []Statement {
+	p.processSymbol('{')
+	statements := p.parseStatements()
+	p.processSymbol('}')
+
+	return statements
+}
+
+func (p *Parser) parseDo() Statement {
+	statement := DoStatement{Node: Node{p.tokenizer.Position()}}
+
+	p.processKeyword("do")
+
+	position := p.tokenizer.Position()
+	call, ok := p.parseTerm().(*CallExpression)
+	if !ok {
+		p.errorAt(position, "expected subroutine call")
+	}
+	statement.Call = call
+
+	p.processSymbol(';')
+
+	return &statement
+}
+
+func (p *Parser) parseReturn() Statement {
+	statement := ReturnStatement{Node: Node{p.tokenizer.Position()}}
+
+	p.processKeyword("return")
+	if p.tokenizer.Symbol() != ';' {
+		statement.Value = p.parseExpression()
+	}
+	p.processSymbol(';')
+
+	return &statement
+}
+
+// parseExpression parses a chain of operators from left to right, and warns
+// once about an operator that binds more strongly than one before it, since
+// it would be applied first with precedence
+func (p *Parser) parseExpression() Expression {
+	if p.precedence {
+		return p.parseOperators(1)
+	}
+
+	expression := p.parseTerm()
+	lowest, warned := 0, false
+
+	for strings.ContainsRune("+-*/&|<>=", p.tokenizer.Symbol()) {
+		position := p.tokenizer.Position()
+		symbol := p.processSymbol(-1)
+
+		level := operatorLevels[symbol]
+		if lowest > 0 && level > lowest && !warned {
+			p.warnAt(position, "'%c' applies to the result of the operators before it, since Jack evaluates from left to right; use parentheses", symbol)
+			warned = true
+		}
+		if lowest == 0 || level < lowest {
+			lowest = level
+		}
+
+		expression = &BinaryExpression{Node{position}, symbol, expression, p.parseTerm()}
+	}
+
+	return expression
+}
+
+// parseOperators parses terms joined by operators that bind at least as
+// strongly as level, grouping operators of the same level from the left
+func (p *Parser) parseOperators(level int) Expression {
+	expression := p.parseTerm()
+
+	for {
+		operatorLevel, ok := operatorLevels[p.tokenizer.Symbol()]
+		if !ok || operatorLevel < level {
+			return expression
+		}
+
+		position := p.tokenizer.Position()
+		symbol := p.processSymbol(-1)
+		expression = &BinaryExpression{Node{position}, symbol, expression, p.parseOperators(operatorLevel + 1)}
+	}
+}
+
+func (p *Parser) parseTerm() Expression {
+	position := p.tokenizer.Position()
+
+	switch p.tokenizer.TokenType() {
+	case TOKEN_TYPE_INT_CONST:
+		return &IntegerConstant{Node{position}, p.processIntConst()}
+
+	case TOKEN_TYPE_STRING_CONST:
+		return &StringConstant{Node{position}, p.processStringConst()}
+
+	case TOKEN_TYPE_IDENTIFIER:
+		identifier := p.processIdentifier()
+
+		switch p.tokenizer.Symbol() {
+		case '[':
+			p.processSymbol('[')
+			index := p.parseExpression()
+			p.processSymbol(']')
+			return &IndexExpression{Node{position}, identifier, index}
+
+		case '(':
+			return &CallExpression{Node{position}, "", identifier, p.parseArguments()}
+
+		case '.':
+			p.processSymbol('.')
+			name := p.processIdentifier()
+			return &CallExpression{Node{position}, identifier, name, p.parseArguments()}
+		}
+
+		return &VariableExpression{Node{position}, identifier}
+
+	case TOKEN_TYPE_KEYWORD:
+		switch keyword := p.tokenizer.KeyWord(); keyword {
+		case KEYWORD_TRUE, KEYWORD_FALSE, KEYWORD_NULL, KEYWORD_THIS:
+			p.processKeyword("")
+			return &KeywordConstant{Node{position}, keyword}
+		}
+
+	case TOKEN_TYPE_SYMBOL:
+		switch p.tokenizer.Symbol() {
+		case '(':
+			p.processSymbol('(')
+			inner := p.parseExpression()
+			p.processSymbol(')')
+			return &ParenExpression{Node{position}, inner}
+
+		case '-', '~':
+			symbol := p.processSymbol(-1)
+			return &UnaryExpression{Node{position}, symbol, p.parseTerm()}
+		}
+	}
+
+	p.expected("expression")
+	return nil
+}
+
+func (p *Parser) parseArguments() []Expression {
+	var arguments []Expression
+
+	p.processSymbol('(')
+
+	for p.tokenizer.Symbol() != ')' {
+		arguments = append(arguments, p.parseExpression())
+
+		if p.tokenizer.Symbol() != ',' {
+			break
+		}
+		p.processSymbol(',')
+	}
+
+	p.processSymbol(')')
+
+	return arguments
+}
+
+// processReturnType is processType that also accepts void, which is only a
+// return type
+func (p *Parser) processReturnType() Type {
+	if p.tokenizer.KeyWord() == KEYWORD_VOID {
+		result := Type{Node{p.tokenizer.Position()}, KEYWORD_VOID.String()}
+		p.processKeyword("void")
+		return result
+	}
+	return p.processType()
+}
+
+func (p *Parser) processType() Type {
+	result := Type{Node: Node{p.tokenizer.Position()}}
+
+	switch p.tokenizer.TokenType() {
+	case TOKEN_TYPE_KEYWORD:
+		switch keyword := p.tokenizer.KeyWord(); keyword {
+		case KEYWORD_INT, KEYWORD_CHAR, KEYWORD_BOOLEAN:
+			result.Name = keyword.String()
+		default:
+			p.expected("type")
+		}
+		p.processKeyword("")
+
+	case TOKEN_TYPE_IDENTIFIER:
+		result.Name = p.processIdentifier()
+
+	default:
+		p.expected("type")
+	}
+
+	return result
+}
+
+func (p *Parser) processKeyword(expected string) KeyWord {
+	keyword := p.tokenizer.KeyWord()
+
+	if len(expected) > 0 {
+		value, ok := stringToKeyword[expected]
+		if !ok {
+			panic("invalid keyword: " + expected)
+		}
+
+		if value != keyword {
+			p.expected("'" + expected + "'")
+		}
+	} else if keyword == KEYWORD_UNKNOWN {
+		p.expected("keyword")
+	}
+
+	p.tokenizer.Advance()
+
+	return keyword
+}
+
+func (p *Parser) processSymbol(expected rune) rune {
+	symbol := p.tokenizer.Symbol()
+
+	if expected >= 0 && expected != symbol {
+		p.expected(fmt.Sprintf("'%c'", expected))
+	} else if symbol == 0 {
+		p.expected("symbol")
+	}
+
+	p.tokenizer.Advance()
+
+	return symbol
+}
+
+func (p *Parser) processIdentifier() string {
+	if p.tokenizer.TokenType() != TOKEN_TYPE_IDENTIFIER {
+		p.expected("identifier")
+	}
+
+	identifier := p.tokenizer.Identifier()
+	p.tokenizer.Advance()
+	return identifier
+}
+
+func (p *Parser) processIntConst() int {
+	if p.tokenizer.TokenType() != TOKEN_TYPE_INT_CONST {
+		p.expected("integer constant")
+	}
+
+	intVal := p.tokenizer.IntVal()
+	p.tokenizer.Advance()
+	return intVal
+}
+
+func (p *Parser) processStringConst() string {
+	if p.tokenizer.TokenType() != TOKEN_TYPE_STRING_CONST {
+		p.expected("string constant")
+	}
+
+	stringVal := p.tokenizer.StringVal()
+	p.tokenizer.Advance()
+	return stringVal
+}
+
+// expected reports that the current token is not what the grammar expects
+// here, or why it is not a valid token at all
+func (p *Parser) expected(what string) {
+	if p.tokenizer.TokenType() == TOKEN_TYPE_UNKNOWN {
+		p.errorf("%s", p.tokenizer.Err())
+	}
+
+	p.errorf("expected %s but found %s", what, p.found())
+}
+
+// found describes the current token for error messages
+func (p *Parser) found() string {
+	switch p.tokenizer.TokenType() {
+	case TOKEN_TYPE_EOF:
+		return "end of file"
+	case TOKEN_TYPE_STRING_CONST:
+		return "string constant " + p.tokenizer.Text()
+	}
+
+	return "'" + p.tokenizer.Text() + "'"
+}
+
+func (p *Parser) errorf(format string, a ...interface{}) {
+	p.errorAt(p.tokenizer.Position(), format, a...)
+}
+
+// errorAt records the error, unless there already is one at the same
+// position, and unwinds to the enclosing recoverAt
+func (p *Parser) errorAt(position Position, format string, a ...interface{}) {
+	if len(p.errs) == 0 || p.errs[len(p.errs)-1].Position != position {
+		p.errs = append(p.errs, &Error{
+			File:     p.file,
+			Position: position,
+			Message:  fmt.Sprintf(format, a...),
+		})
+	}
+
+	panic(bailout{})
+}
+
+func (p *Parser) warnAt(position Position, format string, a ...interface{}) {
+	p.warnings = append(p.warnings, &Error{
+		File:     p.file,
+		Position: position,
+		Message:  fmt.Sprintf(format, a...),
+		Warning:  true,
+	})
+}
+
+// recoverAt parses a declaration or statement and, if it fails, skips to the
+// next synchronization point of the given level. The token the error
+// occurred at is skipped if parse did not get past it, so that the caller
+// always makes progress.
+func (p *Parser) recoverAt(level int, parse func()) {
+	start := p.tokenizer.Position()
+
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(bailout); !ok {
+				panic(r)
+			}
+
+			if p.tokenizer.Position() == start {
+				p.tokenizer.Advance()
+			}
+			p.synchronize(level)
+		}
+	}()
+
+	parse()
+}
+
+// synchronize skips tokens up to the next declaration, or the next statement
+// or variable declaration after a ';', stepping over whole blocks in braces;
+// a '}' that closes the enclosing block is left for the caller
+func (p *Parser) synchronize(level int) {
+	depth := 0
+
+	for p.tokenizer.TokenType() != TOKEN_TYPE_EOF {
+		symbol, keyword := p.tokenizer.Symbol(), p.tokenizer.KeyWord()
+
+		switch {
+		case symbol == '{':
+			depth++
+		case symbol == '}':
+			if depth == 0 {
+				return
+			}
+			depth--
+		case depth > 0:
+		case level == syncStatement && symbol == ';':
+			p.tokenizer.Advance()
+			return
+		case level == syncStatement && statementKeywords[keyword]:
+			return
+		case level == syncDeclaration && declarationKeywords[keyword]:
+			return
+		}
+
+		p.tokenizer.Advance()
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import "strings"
+
+// Signature is the declaration of a subroutine as seen by its callers.
+type Signature struct {
+	Class      string
+	Kind       KeyWord
+	ReturnType string
+	Name       string
+	Parameters []string
+}
+
+func (s *Signature) String() string {
+	return s.Class + "." + s.Name
+}
+
+// ClassInfo holds the subroutines a class declares.
+type ClassInfo struct {
+	Name        string
+	Subroutines map[string]*Signature
+}
+
+// the API of the Jack OS, which every program can call without compiling the
+// OS along with it
+var osAPI []string = []string{
+	"function void Math.init()",
+	"function int Math.abs(int x)",
+	"function int Math.multiply(int x, int y)",
+	"function int Math.divide(int x, int y)",
+	"function int Math.min(int x, int y)",
+	"function int Math.max(int x, int y)",
+	"function int Math.sqrt(int x)",
+
+	"constructor String String.new(int maxLength)",
+	"method void String.dispose()",
+	"method int String.length()",
+	"method char String.charAt(int j)",
+	"method void String.setCharAt(int j, char c)",
+	"method String String.appendChar(char c)",
+	"method void String.eraseLastChar()",
+	"method int String.intValue()",
+	"method void String.setInt(int val)",
+	"function char String.backSpace()",
+	"function char String.doubleQuote()",
+	"function char String.newLine()",
+
+	"function Array Array.new(int size)",
+	"method void Array.dispose()",
+
+	"function void Output.init()",
+	"function void Output.moveCursor(int i, int j)",
+	"function void Output.printChar(char c)",
+	"function void Output.printString(String s)",
+	"function void Output.printInt(int i)",
+	"function void Output.println()",
+	"function void Output.backSpace()",
+
+	"function void Screen.init()",
+	"function void Screen.clearScreen()",
+	"function void Screen.setColor(boolean b)",
+	"function void Screen.drawPixel(int x, int y)",
+	"function void Screen.drawLine(int x1, int y1, int x2, int y2)",
+	"function void Screen.drawRectangle(int x1, int y1, int x2, int y2)",
+	"function void Screen.drawCircle(int x, int y, int r)",
+
+	"function void Keyboard.init()",
+	"function char Keyboard.keyPressed()",
+	"function char Keyboard.readChar()",
+	"function String Keyboard.readLine(String message)",
+	"function int Keyboard.readInt(String message)",
+
+	"function void Memory.init()",
+	"function int Memory.peek(int address)",
+	"function void Memory.poke(int address, int value)",
+	"function Array Memory.alloc(int size)",
+	"function void Memory.deAlloc(Array o)",
+
+	"function void Sys.init()",
+	"function void Sys.halt()",
+	"function void Sys.error(int errorCode)",
+	"function void Sys.wait(int duration)",
+
+	// Sys.init calls the program's Main.main, declared here so that the OS
+	// compiles on its own
+	"function void Main.main()",
+}
+
+// NewClassTable collects the signatures of the OS API and of classes. A class
+// of the program replaces the OS class of the same name, so that the OS can
+// be compiled along with the program.
+func NewClassTable(classes []*Class) map[string]*ClassInfo {
+	table := make(map[string]*ClassInfo)
+
+	for _, declaration := range osAPI {
+		s := parseSignature(declaration)
+		info, ok := table[s.Class]
+		if !ok {
+			info = &ClassInfo{Name: s.Class, Subroutines: make(map[string]*Signature)}
+			table[s.Class] = info
+		}
+		info.Subroutines[s.Name] = s
+	}
+
+	for _, class := range classes {
+		info := &ClassInfo{Name: class.Name, Subroutines: make(map[string]*Signature)}
+		for _, subroutine := range class.Subroutines {
+			if _, ok := info.Subroutines[subroutine.Name]; ok {
+				continue
+			}
+			s := Signature{
+				Class:      class.Name,
+				Kind:       subroutine.Kind,
+				ReturnType: subroutine.ReturnType.Name,
+				Name:       subroutine.Name,
+			}
+			for _, v := range subroutine.Parameters {
+				s.Parameters = append(s.Parameters, v.Type.Name)
+			}
+			info.Subroutines[s.Name] = &s
+		}
+		table[class.Name] = info
+	}
+
+	return table
+}
+
+// parseSignature parses a declaration of osAPI
+func parseSignature(declaration string) *Signature {
+	fields := strings.FieldsFunc(declaration, func(r rune) bool {
+		return strings.ContainsRune(" (),.", r)
+	})
+
+	s := Signature{
+		Kind:       stringToKeyword[fields[0]],
+		ReturnType: fields[1],
+		Class:      fields[2],
+		Name:       fields[3],
+	}
+	for i := 4; i+1 < len(fields); i += 2 {
+		s.Parameters = append(s.Parameters, fields[i])
+	}
+
+	return &s
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"fmt"
 	"os"
 	"strconv"
 	"strings"
@@ -17,6 +18,7 @@ const (
 	TOKEN_TYPE_IDENTIFIER
 	TOKEN_TYPE_INT_CONST
 	TOKEN_TYPE_STRING_CONST
+	TOKEN_TYPE_EOF
 )
 
 var tokenTypeNames = []string{
@@ -26,6 +28,7 @@ var tokenTypeNames = []string{
 	"TOKEN_TYPE_IDENTIFIER",
 	"TOKEN_TYPE_INT_CONST",
 	"TOKEN_TYPE_STRING_CONST",
+	"TOKEN_TYPE_EOF",
 }
 
 func (t TokenType) String() string {
@@ -110,181 +113,252 @@ var stringToKeyword map[string]KeyWord = map[string]KeyWord{
 	KEYWORD_THIS.String():        KEYWORD_THIS,
 }
 
-type Tokenizer struct {
-	scanner   *bufio.Scanner
+// Position is the line and column of a token, both counted from 1.
+type Position struct {
+	Line   int
+	Column int
+}
+
+type token struct {
+	text      string
 	tokenType TokenType
-	next      string
-	current   string
-	line      string
-	inComment bool
+	position  Position
+	err       string
+}
+
+type Tokenizer struct {
+	scanner    *bufio.Scanner
+	current    token
+	next       token
+	line       string
+	lineNumber int
+	column     int
+	inComment  bool
+	commentPos Position
+	eof        bool
 }
 
 func NewTokenizer(input *os.File) *Tokenizer {
 	scanner := bufio.NewScanner(input)
 
 	t := Tokenizer{
-		scanner:   scanner,
-		tokenType: TOKEN_TYPE_UNKNOWN,
-		next:      "init",
-		current:   "",
-		line:      "",
-		inComment: false,
+		scanner: scanner,
 	}
 
-	t.Advance()
-	t.current = ""
+	t.scan()
 
 	return &t
 }
 
 func (t *Tokenizer) HasMoreTokens() bool {
-	return len(t.next) > 0
+	return t.next.tokenType != TOKEN_TYPE_EOF
 }
 
 func (t *Tokenizer) Advance() {
-	if t.HasMoreTokens() {
-		t.current = t.next
-		t.setTokenType()
-
-		for {
-			if len(t.line) > 0 {
-				end := strings.IndexAny(t.line, " {}()[].,;+-*/&|<>=~\"")
-
-				if end > 0 {
-					t.next = t.line[0:end]
-					t.line = t.line[end:]
-				} else if end < 0 {
-					t.next = t.line
-					t.line = ""
-				} else if t.line[0] == '"' {
-					end = strings.IndexRune(t.line[1:], '"') + 1
-					t.next = t.line[0 : end+1]
-					t.line = t.line[end+1:]
-				} else {
-					t.next = t.line[0:1]
-					t.line = t.line[1:]
-				}
-
-				t.line = strings.TrimSpace(t.line)
-				break
-			}
+	t.current = t.next
+	if t.current.tokenType != TOKEN_TYPE_EOF {
+		t.scan()
+	}
+}
 
-			if ok := t.scanner.Scan(); !ok {
-				err := t.scanner.Err()
-				if err != nil {
-					panic(err)
-				}
+// scan reads the token after the current one into next
+func (t *Tokenizer) scan() {
+	for {
+		for t.column < len(t.line) && (t.line[t.column] == ' ' || t.line[t.column] == '\t' || t.line[t.column] == '\r') {
+			t.column++
+		}
 
-				t.next = ""
-				break
+		if t.column >= len(t.line) {
+			if !t.readLine() {
+				return
 			}
+			continue
+		}
 
-			line := t.scanner.Text()
+		rest := t.line[t.column:]
 
-			if t.inComment {
-				blockCommentEnd := strings.Index(line, "*/")
-				if blockCommentEnd > 0 {
-					line = line[blockCommentEnd+2:]
-					t.inComment = false
-				} else {
-					line = ""
-				}
+		switch {
+		case t.inComment:
+			end := strings.Index(rest, "*/")
+			if end < 0 {
+				t.column = len(t.line)
+			} else {
+				t.column += end + 2
+				t.inComment = false
 			}
 
-			if !t.inComment {
-				if comment := strings.Index(line, "//"); comment >= 0 {
-					line = line[:comment]
-				}
-
-				for {
-					blockCommentStart := strings.Index(line, "/*")
-					if blockCommentStart < 0 {
-						break
-					}
-
-					blockCommentEnd := strings.Index(line, "*/")
-					if blockCommentEnd < 0 {
-						t.inComment = true
-						line = line[:blockCommentStart]
-						break
-					}
-
-					line = line[:blockCommentStart] + " " + line[blockCommentEnd+2:]
-				}
-			}
+		case strings.HasPrefix(rest, "//"):
+			t.column = len(t.line)
 
-			t.line = strings.TrimSpace(line)
+		case strings.HasPrefix(rest, "/*"):
+			t.inComment = true
+			t.commentPos = t.position()
+			t.column += 2
+
+		default:
+			t.next = t.lex(rest)
+			t.column += len(t.next.text)
+			return
 		}
 	}
 }
 
+// readLine moves to the next line of input, or sets next to the end of file
+// token, or an error token for an unterminated comment or a read error
+func (t *Tokenizer) readLine() bool {
+	if t.scanner.Scan() {
+		t.line = t.scanner.Text()
+		t.lineNumber++
+		t.column = 0
+		return true
+	}
+
+	t.next = token{tokenType: TOKEN_TYPE_EOF, position: t.position()}
+
+	switch err := t.scanner.Err(); {
+	case err != nil:
+		t.next = token{tokenType: TOKEN_TYPE_UNKNOWN, position: t.position(), err: err.Error()}
+	case t.inComment:
+		t.inComment = false
+		t.next = token{tokenType: TOKEN_TYPE_UNKNOWN, position: t.commentPos, err: "unterminated comment"}
+		t.line = ""
+	}
+
+	return false
+}
+
+func (t *Tokenizer) position() Position {
+	return Position{t.lineNumber, t.column + 1}
+}
+
+func (t *Tokenizer) lex(rest string) token {
+	tok := token{position: t.position()}
+
+	switch c := rest[0]; {
+	case c == '"':
+		end := strings.IndexRune(rest[1:], '"')
+		if end < 0 {
+			tok.text = rest
+			tok.err = "unterminated string constant"
+			break
+		}
+		tok.text = rest[:end+2]
+		tok.tokenType = TOKEN_TYPE_STRING_CONST
+
+	case strings.IndexByte(symbols, c) >= 0:
+		tok.text = rest[:1]
+		tok.tokenType = TOKEN_TYPE_SYMBOL
+
+	case isDigit(c):
+		tok.text = rest[:wordLength(rest)]
+		value, err := strconv.Atoi(tok.text)
+		switch {
+		case err != nil && strings.Trim(tok.text, "0123456789") == "":
+			tok.err = "integer constant out of range: " + tok.text
+		case err != nil:
+			tok.err = "invalid integer constant: " + tok.text
+		case value > 32767:
+			tok.err = "integer constant out of range: " + tok.text
+		default:
+			tok.tokenType = TOKEN_TYPE_INT_CONST
+		}
+
+	case isLetter(c):
+		tok.text = rest[:wordLength(rest)]
+		tok.tokenType = TOKEN_TYPE_IDENTIFIER
+		if _, ok := stringToKeyword[tok.text]; ok {
+			tok.tokenType = TOKEN_TYPE_KEYWORD
+		}
+
+	default:
+		tok.text = rest[:1]
+		tok.err = fmt.Sprintf("invalid character %q", c)
+	}
+
+	return tok
+}
+
 func (t *Tokenizer) TokenType() TokenType {
-	return t.tokenType
+	return t.current.tokenType
 }
 
+// Position returns the position of the current token.
+func (t *Tokenizer) Position() Position {
+	return t.current.position
+}
+
+// Text returns the current token as it appears in the source.
+func (t *Tokenizer) Text() string {
+	return t.current.text
+}
+
+// Err describes why the current token is invalid, if its type is
+// TOKEN_TYPE_UNKNOWN.
+func (t *Tokenizer) Err() string {
+	return t.current.err
+}
+
+// KeyWord returns the current keyword, or KEYWORD_UNKNOWN if the current
+// token is not a keyword.
 func (t *Tokenizer) KeyWord() KeyWord {
-	if t.tokenType != TOKEN_TYPE_KEYWORD {
-		panic("token type is not keyword: " + t.current)
+	if t.current.tokenType != TOKEN_TYPE_KEYWORD {
+		return KEYWORD_UNKNOWN
 	}
 
-	return stringToKeyword[t.current]
+	return stringToKeyword[t.current.text]
 }
 
+// Symbol returns the current symbol, or 0 if the current token is not a
+// symbol.
 func (t *Tokenizer) Symbol() rune {
-	if t.tokenType != TOKEN_TYPE_SYMBOL {
-		panic("token type is not symbol: " + t.current)
+	if t.current.tokenType != TOKEN_TYPE_SYMBOL {
+		return 0
 	}
 
-	return rune(t.current[0])
+	return rune(t.current.text[0])
 }
 
 func (t *Tokenizer) Identifier() string {
-	if t.tokenType != TOKEN_TYPE_IDENTIFIER {
-		panic("token type is not identifier: " + t.current)
+	if t.current.tokenType != TOKEN_TYPE_IDENTIFIER {
+		return ""
 	}
 
-	return t.current
+	return t.current.text
 }
 
 func (t *Tokenizer) IntVal() int {
-	if t.tokenType != TOKEN_TYPE_INT_CONST {
-		panic("token type is not intval: " + t.current)
+	if t.current.tokenType != TOKEN_TYPE_INT_CONST {
+		return 0
 	}
 
-	val, err := strconv.ParseInt(t.current, 10, 16)
-	if err != nil {
-		panic(err)
-	}
-
-	return int(val)
+	val, _ := strconv.Atoi(t.current.text)
+	return val
 }
 
 func (t *Tokenizer) StringVal() string {
-	if t.tokenType != TOKEN_TYPE_STRING_CONST {
-		panic("token type is not stringval: " + t.current)
+	if t.current.tokenType != TOKEN_TYPE_STRING_CONST {
+		return ""
 	}
 
-	return t.current[1 : len(t.current)-1]
+	return t.current.text[1 : len(t.current.text)-1]
 }
 
-func (t *Tokenizer) setTokenType() {
-	switch {
-	case t.current[0] == '"':
-		t.tokenType = TOKEN_TYPE_STRING_CONST
-
-	case strings.ContainsRune("0123456789", rune(t.current[0])):
-		t.tokenType = TOKEN_TYPE_INT_CONST
+const symbols = "{}()[].,;+-*/&|<>=~"
 
-	case len(t.current) == 1 && strings.ContainsRune("{}()[].,;+-*/&|<>=~", rune(t.current[0])):
-		t.tokenType = TOKEN_TYPE_SYMBOL
-
-	case stringToKeyword[t.current] != 0 && stringToKeyword[t.current] != KEYWORD_UNKNOWN:
-		t.tokenType = TOKEN_TYPE_KEYWORD
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
 
-	case !strings.ContainsAny(t.current, "{}()[].,;+-*/&|<>=~"):
-		t.tokenType = TOKEN_TYPE_IDENTIFIER
+func isLetter(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
 
-	default:
-		panic("invalid token: " + t.current)
+// the length of the identifier or integer constant at the start of s
+func wordLength(s string) int {
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) && !isLetter(s[i]) {
+			return i
+		}
 	}
+	return len(s)
 }
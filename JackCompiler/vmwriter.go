@@ -2,7 +2,7 @@ package main
 
 import (
 	"bufio"
-	"os"
+	"io"
 	"strconv"
 )
 
@@ -57,6 +57,8 @@ const (
 	ARITHMETIC_COMMAND_AND
 	ARITHMETIC_COMMAND_OR
 	ARITHMETIC_COMMAND_NOT
+	ARITHMETIC_COMMAND_SHL
+	ARITHMETIC_COMMAND_SHR
 )
 
 var arithmeticCommandNames = []string{
@@ -70,6 +72,8 @@ var arithmeticCommandNames = []string{
 	"and",
 	"or",
 	"not",
+	"shl",
+	"shr",
 }
 
 func (a ArithmeticCommand) String() string {
@@ -77,10 +81,12 @@ func (a ArithmeticCommand) String() string {
 }
 
 type VMWriter struct {
-	writer *bufio.Writer
+	writer   *bufio.Writer
+	err      error
+	commands int
 }
 
-func NewVMWriter(output *os.File) *VMWriter {
+func NewVMWriter(output io.Writer) *VMWriter {
 	writer := bufio.NewWriter(output)
 
 	v := VMWriter{
@@ -126,12 +132,26 @@ func (v *VMWriter) WriteReturn() {
 	v.write("return")
 }
 
-func (v *VMWriter) write(value string) {
-	if _, err := v.writer.WriteString(value + "\n"); err != nil {
-		panic(err)
+// Commands returns the number of commands written.
+func (v *VMWriter) Commands() int {
+	return v.commands
+}
+
+// Flush writes the buffered output and returns the first write error.
+func (v *VMWriter) Flush() error {
+	if v.err != nil {
+		return v.err
 	}
 
-	if err := v.writer.Flush(); err != nil {
-		panic(err)
+	return v.writer.Flush()
+}
+
+func (v *VMWriter) write(value string) {
+	v.commands++
+
+	if v.err != nil {
+		return
 	}
+
+	_, v.err = v.writer.WriteString(value + "\n")
 }
@@ -0,0 +1,167 @@
+package backend
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/pcjun97/JackVMTranslator/parser"
+)
+
+// Backend generates code for a target from VM commands. Commands of each
+// input file are preceded by SetFileName with the name used to namespace the
+// static segment, and Close is called once after the last file.
+type Backend interface {
+	SetFileName(fileName string)
+	Arithmetic(command string) error
+	PushPop(command, segment string, index int) error
+	Label(label string) error
+	Goto(label string) error
+	If(label string) error
+	Function(name string, nVars int) error
+	Call(name string, nArgs int) error
+	Return() error
+	Close() error
+}
+
+// TailCaller is implemented by backends that can write a call immediately
+// followed by return without growing the stack.
+type TailCaller interface {
+	TailCall(name string, nArgs int) error
+}
+
+// Annotator is implemented by backends that carry the origin of every command
+// into their output: the .vm file and line, the Jack source position of the
+// last @line annotation and the comment of the command, if any.
+type Annotator interface {
+	Annotate(fileName string, line int, source, comment string)
+}
+
+// Forker is implemented by backends that can translate files independently.
+// Fork returns a backend for a single file, or nil if files cannot be
+// translated apart, and Join appends what a forked backend wrote.
+type Forker interface {
+	Fork() Backend
+	Join(b Backend) error
+}
+
+// Write passes a single command to the matching Backend method.
+func Write(b Backend, command parser.Command) error {
+	switch command.Type {
+	case parser.C_ARITHMETIC:
+		return b.Arithmetic(command.Arg1)
+	case parser.C_PUSH:
+		return b.PushPop("push", command.Arg1, command.Arg2)
+	case parser.C_POP:
+		return b.PushPop("pop", command.Arg1, command.Arg2)
+	case parser.C_LABEL:
+		return b.Label(command.Arg1)
+	case parser.C_GOTO:
+		return b.Goto(command.Arg1)
+	case parser.C_IF:
+		return b.If(command.Arg1)
+	case parser.C_FUNCTION:
+		return b.Function(command.Arg1, command.Arg2)
+	case parser.C_CALL:
+		return b.Call(command.Arg1, command.Arg2)
+	case parser.C_RETURN:
+		return b.Return()
+	}
+
+	return fmt.Errorf("unknown command type %d", command.Type)
+}
+
+// Translate writes the commands of one input file.
+func Translate(b Backend, fileName string, commands []parser.Command) error {
+	current := fileName
+	b.SetFileName(current)
+
+	tailCaller, canTailCall := b.(TailCaller)
+	annotator, canAnnotate := b.(Annotator)
+
+	for i := 0; i < len(commands); i++ {
+		command := commands[i]
+		namespace := command.Namespace
+		if namespace == "" {
+			namespace = fileName
+		}
+		if namespace != current {
+			current = namespace
+			b.SetFileName(current)
+		}
+
+		if canAnnotate {
+			annotator.Annotate(fileName, command.Line, command.Source, command.Comment)
+		}
+
+		if canTailCall && command.Type == parser.C_CALL && i+1 < len(commands) && commands[i+1].Type == parser.C_RETURN {
+			if err := tailCaller.TailCall(command.Arg1, command.Arg2); err != nil {
+				return fmt.Errorf("%s.vm:%d: %w", fileName, command.Line, err)
+			}
+			i++
+			continue
+		}
+
+		if err := Write(b, command); err != nil {
+			return fmt.Errorf("%s.vm:%d: %w", fileName, command.Line, err)
+		}
+	}
+
+	return nil
+}
+
+// TranslateFiles writes the commands of every file in order. If b is a Forker
+// and workers is above 1, up to workers files are translated concurrently,
+// each by its own fork, and the forks are joined in file order, so the output
+// does not depend on the order they finish in.
+func TranslateFiles(b Backend, files []parser.File, workers int) error {
+	forker, ok := b.(Forker)
+	if !ok || workers < 2 || len(files) < 2 {
+		return translateFiles(b, files)
+	}
+
+	parts := make([]Backend, len(files))
+	for i := range files {
+		parts[i] = forker.Fork()
+		if parts[i] == nil {
+			return translateFiles(b, files)
+		}
+	}
+
+	errs := make([]error, len(files))
+	semaphore := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+
+	for i, file := range files {
+		wg.Add(1)
+		semaphore <- struct{}{}
+
+		go func(i int, file parser.File) {
+			defer wg.Done()
+			errs[i] = Translate(parts[i], file.Name, file.Commands)
+			<-semaphore
+		}(i, file)
+	}
+
+	wg.Wait()
+
+	for i := range files {
+		if errs[i] != nil {
+			return errs[i]
+		}
+		if err := forker.Join(parts[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func translateFiles(b Backend, files []parser.File) error {
+	for _, file := range files {
+		if err := Translate(b, file.Name, file.Commands); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,351 @@
+package cgen
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	_ "embed"
+)
+
+//go:embed embeds/header.c
+var headerC string
+
+//go:embed embeds/footer.c
+var footerC string
+
+var segmentBase map[string]int = map[string]int{
+	"local":    1,
+	"argument": 2,
+	"this":     3,
+	"that":     4,
+}
+
+var indirectBase map[string]int = map[string]int{
+	"local-indirect":    1,
+	"argument-indirect": 2,
+	"this-indirect":     3,
+	"that-indirect":     4,
+}
+
+var segmentSize map[string]int = map[string]int{
+	"pointer": 2,
+	"temp":    8,
+}
+
+var segmentFixed map[string]int = map[string]int{
+	"pointer": 3,
+	"temp":    5,
+}
+
+var binaryOperators map[string]string = map[string]string{
+	"add": "(int16_t)(TOP + t)",
+	"sub": "(int16_t)(TOP - t)",
+	"and": "TOP & t",
+	"or":  "TOP | t",
+	"xor": "TOP ^ t",
+	"mul": "(int16_t)(TOP * t)",
+	"div": "(int16_t)(TOP / t)",
+	"eq":  "TOP == t ? -1 : 0",
+	"gt":  "TOP > t ? -1 : 0",
+	"lt":  "TOP < t ? -1 : 0",
+	"le":  "TOP <= t ? -1 : 0",
+	"ge":  "TOP >= t ? -1 : 0",
+	"ne":  "TOP != t ? -1 : 0",
+}
+
+var unaryOperators map[string]string = map[string]string{
+	"neg": "(int16_t)-TOP",
+	"not": "~TOP",
+	"shl": "(int16_t)(TOP * 2)",
+	"shr": "(int16_t)(TOP / 2)",
+}
+
+// CodeWriter translates VM commands into a single C file. VM functions and
+// return addresses become cases of a switch in run(), so the stack, frames
+// and segments live in RAM exactly as on the Hack platform.
+type CodeWriter struct {
+	writer    io.Writer
+	body      bytes.Buffer
+	fileName  string
+	function  string
+	cases     int
+	functions map[string]int
+	defined   map[string]bool
+	labels    map[string]int
+	jumps     map[int]bool
+	statics   map[string]int
+
+	// the label of the previous command if it was a label, since a goto
+	// back to it is the idiom for halting
+	lastLabel string
+}
+
+func NewCodeWriter(w io.Writer) *CodeWriter {
+	c := CodeWriter{
+		writer:    w,
+		functions: make(map[string]int),
+		defined:   make(map[string]bool),
+		labels:    make(map[string]int),
+		jumps:     make(map[int]bool),
+		statics:   make(map[string]int),
+	}
+
+	c.cases = 1
+	c.write("\tcase 0:\n\t\tRAM[0] = 256;\n")
+	c.Call("Sys.init", 0)
+	c.write("\t\thalt(0);\n")
+
+	return &c
+}
+
+func (c *CodeWriter) SetFileName(fileName string) {
+	c.fileName = fileName
+}
+
+func (c *CodeWriter) Arithmetic(command string) error {
+	c.write(fmt.Sprintf("\t\t// %s\n", command))
+
+	if operator, ok := binaryOperators[command]; ok {
+		if command == "div" {
+			c.write(fmt.Sprintf("\t\tif (TOP == 0) {\n\t\t\tfatal(\"division by zero\", %q);\n\t\t}\n", c.function))
+		}
+		c.write(fmt.Sprintf("\t\tt = pop();\n\t\tTOP = %s;\n", operator))
+		return nil
+	}
+
+	if operator, ok := unaryOperators[command]; ok {
+		c.write(fmt.Sprintf("\t\tTOP = %s;\n", operator))
+		return nil
+	}
+
+	return fmt.Errorf("unknown arithmetic command: %s", command)
+}
+
+func (c *CodeWriter) PushPop(command, segment string, index int) error {
+	if base, ok := indirectBase[segment]; ok {
+		c.write(fmt.Sprintf("\t\t// %s %s\n", command, segment))
+
+		switch command {
+		case "push":
+			c.write(fmt.Sprintf("\t\tt = pop();\n\t\tpush(M(RAM[%d] + t));\n", base))
+		case "pop":
+			c.write(fmt.Sprintf("\t\tt = pop();\n\t\tu = pop();\n\t\tM(RAM[%d] + u) = t;\n", base))
+		}
+
+		return nil
+	}
+
+	if segment == "constant" {
+		if command != "push" {
+			return fmt.Errorf("invalid command: %s constant %d", command, index)
+		}
+
+		c.write(fmt.Sprintf("\t\t// push constant %d\n\t\tpush(%d);\n", index, index))
+		return nil
+	}
+
+	address, err := c.getAddress(segment, index)
+	if err != nil {
+		return err
+	}
+
+	c.write(fmt.Sprintf("\t\t// %s %s %d\n", command, segment, index))
+
+	switch command {
+	case "push":
+		c.write(fmt.Sprintf("\t\tpush(%s);\n", address))
+	case "pop":
+		c.write(fmt.Sprintf("\t\tt = pop();\n\t\t%s = t;\n", address))
+	}
+
+	return nil
+}
+
+// Label writes a C label, which Close leaves out if nothing jumps to it
+func (c *CodeWriter) Label(label string) error {
+	c.write(fmt.Sprintf("\t\t// label %s\n\tL%d:;\n", label, c.getLabel(label)))
+	c.lastLabel = label
+	return nil
+}
+
+// Goto ends the program for label X, goto X, which loops forever on the Hack
+// platform, like the VM emulator does
+func (c *CodeWriter) Goto(label string) error {
+	if label == c.lastLabel {
+		c.write(fmt.Sprintf("\t\t// goto %s\n\t\thalt(0);\n", label))
+		return nil
+	}
+
+	c.write(fmt.Sprintf("\t\t// goto %s\n\t\tSTEP();\n\t\tgoto L%d;\n", label, c.getJump(label)))
+	return nil
+}
+
+func (c *CodeWriter) If(label string) error {
+	c.write(fmt.Sprintf("\t\t// if-goto %s\n\t\tif (pop() != 0) {\n\t\t\tSTEP();\n\t\t\tgoto L%d;\n\t\t}\n", label, c.getJump(label)))
+	return nil
+}
+
+func (c *CodeWriter) Function(name string, nVars int) error {
+	if c.defined[name] {
+		return fmt.Errorf("function %s already defined", name)
+	}
+
+	c.defined[name] = true
+	c.function = name
+
+	c.write(fmt.Sprintf("\t// function %s %d\n\tcase %d:\n", name, nVars, c.getFunction(name)))
+	if name == "Sys.halt" {
+		c.write("\t\thalt(0);\n")
+	}
+	for i := 0; i < nVars; i++ {
+		c.write("\t\tpush(0);\n")
+	}
+
+	return nil
+}
+
+func (c *CodeWriter) Call(name string, nArgs int) error {
+	returnAddress := c.cases
+	c.cases++
+
+	c.write(fmt.Sprintf("\t\t// call %s %d\n", name, nArgs))
+	c.write(fmt.Sprintf("\t\tSTEP();\n\t\tpush(%d);\n", returnAddress))
+	c.write("\t\tpush(RAM[1]);\n\t\tpush(RAM[2]);\n\t\tpush(RAM[3]);\n\t\tpush(RAM[4]);\n")
+	c.write(fmt.Sprintf("\t\tRAM[2] = RAM[0] - %d;\n\t\tRAM[1] = RAM[0];\n", 5+nArgs))
+	c.write(fmt.Sprintf("\t\tpc = %d;\n\t\tgoto dispatch;\n\tcase %d:\n", c.getFunction(name), returnAddress))
+
+	return nil
+}
+
+func (c *CodeWriter) Return() error {
+	c.write("\t\t// return\n")
+	c.write("\t\tframe = RAM[1];\n\t\tpc = M(frame - 5);\n")
+	c.write("\t\tt = pop();\n\t\tM(RAM[2]) = t;\n\t\tRAM[0] = RAM[2] + 1;\n")
+	c.write("\t\tRAM[4] = M(frame - 1);\n\t\tRAM[3] = M(frame - 2);\n")
+	c.write("\t\tRAM[2] = M(frame - 3);\n\t\tRAM[1] = M(frame - 4);\n")
+	c.write("\t\tgoto dispatch;\n")
+
+	return nil
+}
+
+// Close writes the complete C file.
+func (c *CodeWriter) Close() error {
+	if c.cases > 32767 {
+		return fmt.Errorf("too many functions and calls: %d", c.cases)
+	}
+
+	writer := bufio.NewWriter(c.writer)
+	writer.WriteString(headerC)
+
+	names := make([]string, 0, len(c.functions))
+	for name := range c.functions {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return c.functions[names[i]] < c.functions[names[j]]
+	})
+
+	fmt.Fprintf(writer, "static const char *names[%d] = {\n\t[0] = \"bootstrap\",\n", c.cases)
+	for _, name := range names {
+		fmt.Fprintf(writer, "\t[%d] = %q,\n", c.functions[name], name)
+	}
+	writer.WriteString("};\n\n")
+
+	writer.WriteString("static void run(void) {\n\tint pc = 0;\n\tint16_t t, u, frame;\n\t(void)t;\n\t(void)u;\n\t(void)frame;\n\n")
+	writer.WriteString("dispatch:\n\tM(KBD) = keyboard();\n\tswitch (pc) {\n")
+	for _, line := range strings.SplitAfter(c.body.String(), "\n") {
+		if id, ok := labelID(line); ok && !c.jumps[id] {
+			continue
+		}
+		writer.WriteString(line)
+	}
+	writer.WriteString("\t\thalt(0);\n\tdefault:\n\t\tfatal(\"undefined function\", pc < (int)(sizeof(names) / sizeof(names[0])) ? names[pc] : NULL);\n\t}\n}\n")
+	writer.WriteString(footerC)
+
+	return writer.Flush()
+}
+
+func (c *CodeWriter) write(output string) {
+	c.body.WriteString(output)
+	c.lastLabel = ""
+}
+
+// returns the C lvalue of a segment slot
+func (c *CodeWriter) getAddress(segment string, index int) (string, error) {
+	if base, ok := segmentBase[segment]; ok {
+		return fmt.Sprintf("M(RAM[%d] + %d)", base, index), nil
+	}
+
+	if size, ok := segmentSize[segment]; ok {
+		if index >= size {
+			return "", fmt.Errorf("%s index out of range: %d", segment, index)
+		}
+		return fmt.Sprintf("RAM[%d]", segmentFixed[segment]+index), nil
+	}
+
+	if segment == "static" {
+		return fmt.Sprintf("RAM[%d]", c.getStatic(index)), nil
+	}
+
+	return "", fmt.Errorf("unknown segment: %s", segment)
+}
+
+// statics are allocated from address 16 in order of appearance, the same way
+// the Hack assembler allocates variables
+func (c *CodeWriter) getStatic(index int) int {
+	v := fmt.Sprintf("%s.%d", c.fileName, index)
+
+	address, ok := c.statics[v]
+	if !ok {
+		address = 16 + len(c.statics)
+		c.statics[v] = address
+	}
+
+	return address
+}
+
+func (c *CodeWriter) getFunction(name string) int {
+	id, ok := c.functions[name]
+	if !ok {
+		id = c.cases
+		c.cases++
+		c.functions[name] = id
+	}
+
+	return id
+}
+
+// returns the id of the label a line of the body defines, if it does
+func labelID(line string) (int, bool) {
+	if !strings.HasPrefix(line, "\tL") || !strings.HasSuffix(line, ":;\n") {
+		return 0, false
+	}
+	id, err := strconv.Atoi(strings.TrimSuffix(line[2:], ":;\n"))
+	return id, err == nil
+}
+
+// returns the id of a label that is jumped to
+func (c *CodeWriter) getJump(label string) int {
+	id := c.getLabel(label)
+	c.jumps[id] = true
+	return id
+}
+
+func (c *CodeWriter) getLabel(label string) int {
+	if c.function != "" {
+		label = c.function + "$" + label
+	}
+
+	id, ok := c.labels[label]
+	if !ok {
+		id = len(c.labels)
+		c.labels[label] = id
+	}
+
+	return id
+}
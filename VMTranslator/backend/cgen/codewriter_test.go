@@ -0,0 +1,155 @@
+package cgen_test
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/pcjun97/JackVMTranslator/backend"
+	"github.com/pcjun97/JackVMTranslator/backend/cgen"
+	"github.com/pcjun97/JackVMTranslator/parser"
+)
+
+var ramPattern *regexp.Regexp = regexp.MustCompile(`RAM\[(\d+)`)
+
+// the programs of project 8 that bootstrap through Sys.init, as the C
+// program always does, shared with the hack backend
+var programs []string = []string{
+	"FibonacciElement",
+	"NestedCall",
+	"StaticsTest",
+}
+
+// translates every program to C, compiles it with every warning an error,
+// runs it and compares the RAM it dumps on halt with the .cmp file
+func TestPrograms(t *testing.T) {
+	compiler, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("no C compiler")
+	}
+
+	for _, name := range programs {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			dir := filepath.Join("..", "hack", "testdata", name)
+			source := filepath.Join(t.TempDir(), name+".c")
+			binary := strings.TrimSuffix(source, ".c")
+
+			if err := os.WriteFile(source, translate(t, dir), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			build := exec.Command(compiler, "-std=c11", "-Wall", "-Wextra", "-Werror", "-o", binary, source)
+			if output, err := build.CombinedOutput(); err != nil {
+				t.Fatalf("%v\n%s", err, output)
+			}
+
+			want := expected(t, filepath.Join(dir, name+".cmp"))
+			last := 0
+			for address := range want {
+				if address > last {
+					last = address
+				}
+			}
+
+			output, err := exec.Command(binary, "-s", "100000", "-d", "0:"+strconv.Itoa(last)).Output()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := make(map[int]int16)
+			for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+				var address, value int
+				fields := strings.Fields(line)
+				if len(fields) == 2 {
+					address, _ = strconv.Atoi(fields[0])
+					value, _ = strconv.Atoi(fields[1])
+				}
+				got[address] = int16(value)
+			}
+
+			for address, value := range want {
+				if got[address] != value {
+					t.Errorf("RAM[%d] = %d, want %d", address, got[address], value)
+				}
+			}
+		})
+	}
+}
+
+// a label is only written if a goto or if-goto jumps to it, since the
+// compiler warns about unused labels
+func TestUnusedLabels(t *testing.T) {
+	source := "function Sys.init 0\nlabel UNUSED\nlabel LOOP\npush constant 0\nif-goto LOOP\nlabel END\ngoto END\n"
+	commands, err := parser.Parse(strings.NewReader(source), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var c bytes.Buffer
+	w := cgen.NewCodeWriter(&c)
+	if err := backend.Translate(w, "Sys", commands); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	labels := regexp.MustCompile(`(?m)^\tL\d+:;$`).FindAllString(c.String(), -1)
+	if len(labels) != 1 {
+		t.Errorf("%d labels written, want 1 for LOOP", len(labels))
+	}
+}
+
+func translate(t *testing.T, dir string) []byte {
+	files, err := parser.ReadFiles(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var c bytes.Buffer
+	w := cgen.NewCodeWriter(&c)
+	if err := backend.TranslateFiles(w, files, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return c.Bytes()
+}
+
+// reads the expected RAM values from the header and the value row of a
+// compare file
+func expected(t *testing.T, file string) map[int]int16 {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("%s: expected a header and a value row", file)
+	}
+
+	header := strings.Split(strings.Trim(lines[0], "|"), "|")
+	row := strings.Split(strings.Trim(lines[1], "|"), "|")
+
+	values := make(map[int]int16)
+	for i, cell := range header {
+		match := ramPattern.FindStringSubmatch(cell)
+		if match == nil || i >= len(row) {
+			t.Fatalf("%s: unknown column %s", file, cell)
+		}
+		address, _ := strconv.Atoi(match[1])
+		value, _ := strconv.Atoi(strings.TrimSpace(row[i]))
+		values[address] = int16(value)
+	}
+
+	return values
+}
@@ -0,0 +1,30 @@
+
+static void usage(const char *name) {
+	fprintf(stderr, "usage: %s [-s steps] [-d from:to] [-k key] [-p screen.pbm]\n", name);
+	exit(1);
+}
+
+int main(int argc, char **argv) {
+	for (int i = 1; i < argc; i++) {
+		if (i + 1 >= argc) {
+			usage(argv[0]);
+		}
+
+		if (strcmp(argv[i], "-s") == 0) {
+			limit = atoll(argv[++i]);
+		} else if (strcmp(argv[i], "-d") == 0) {
+			if (sscanf(argv[++i], "%ld:%ld", &dump_from, &dump_to) != 2) {
+				usage(argv[0]);
+			}
+		} else if (strcmp(argv[i], "-k") == 0) {
+			key = (int16_t)atoi(argv[++i]);
+		} else if (strcmp(argv[i], "-p") == 0) {
+			screen_file = argv[++i];
+		} else {
+			usage(argv[0]);
+		}
+	}
+
+	run();
+	halt(0);
+}
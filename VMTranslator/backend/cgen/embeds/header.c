@@ -0,0 +1,78 @@
+/* Generated by VMTranslator. */
+
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+#define SCREEN 16384
+#define KBD 24576
+
+#define M(a) RAM[(uint16_t)(a) & 0x7fff]
+#define TOP M(RAM[0] - 1)
+#define STEP() \
+	if (limit > 0 && ++steps > limit) { \
+		halt(2); \
+	}
+
+static int16_t RAM[32768];
+static long long steps, limit;
+static int16_t key;
+static const char *screen_file;
+static long dump_from = -1, dump_to = -1;
+
+static void push(int16_t v) {
+	M(RAM[0]) = v;
+	RAM[0]++;
+}
+
+static int16_t pop(void) {
+	RAM[0]--;
+	return M(RAM[0]);
+}
+
+/* Stub for the memory-mapped keyboard, refreshed on every call. */
+static int16_t keyboard(void) {
+	return key;
+}
+
+/* Stub for the memory-mapped screen, written as a PBM image on halt. */
+static void write_screen(void) {
+	FILE *f = fopen(screen_file, "wb");
+	if (f == NULL) {
+		perror(screen_file);
+		return;
+	}
+
+	fprintf(f, "P4\n512 256\n");
+	for (int a = SCREEN; a < KBD; a++) {
+		uint16_t w = (uint16_t)RAM[a];
+		unsigned char lo = 0, hi = 0;
+		for (int i = 0; i < 8; i++) {
+			lo |= ((w >> i) & 1) << (7 - i);
+			hi |= ((w >> (i + 8)) & 1) << (7 - i);
+		}
+		fputc(lo, f);
+		fputc(hi, f);
+	}
+
+	fclose(f);
+}
+
+_Noreturn static void halt(int status) {
+	for (long a = dump_from; a >= 0 && a <= dump_to && a < 32768; a++) {
+		printf("%ld %d\n", a, RAM[a]);
+	}
+
+	if (screen_file != NULL) {
+		write_screen();
+	}
+
+	exit(status);
+}
+
+_Noreturn static void fatal(const char *message, const char *detail) {
+	fprintf(stderr, "%s: %s\n", message, detail != NULL ? detail : "?");
+	halt(1);
+}
+
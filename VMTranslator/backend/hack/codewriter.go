@@ -0,0 +1,751 @@
+package hack
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pcjun97/JackVMTranslator/backend"
+	"github.com/pcjun97/JackVMTranslator/parser"
+
+	_ "embed"
+)
+
+//go:embed embeds/init.asm
+var initAsm string
+
+//go:embed embeds/popD.asm
+var popDAsm string
+
+//go:embed embeds/fetchM.asm
+var fetchMAsm string
+
+//go:embed embeds/conditional.asm
+var conditionalAsm string
+
+//go:embed embeds/push.asm
+var pushAsm string
+
+//go:embed embeds/pop.asm
+var popAsm string
+
+//go:embed embeds/pushAddress.asm
+var pushAddressAsm string
+
+//go:embed embeds/pushSymbol.asm
+var pushSymbolAsm string
+
+//go:embed embeds/popSymbol.asm
+var popSymbolAsm string
+
+//go:embed embeds/pushConstant.asm
+var pushConstantAsm string
+
+//go:embed embeds/endLoop.asm
+var endLoopAsm string
+
+//go:embed embeds/goto.asm
+var gotoAsm string
+
+//go:embed embeds/ifgoto.asm
+var ifgotoAsm string
+
+//go:embed embeds/function.asm
+var functionAsm string
+
+//go:embed embeds/call.asm
+var callAsm string
+
+//go:embed embeds/return.asm
+var returnAsm string
+
+//go:embed embeds/xor.asm
+var xorAsm string
+
+//go:embed embeds/shl.asm
+var shlAsm string
+
+//go:embed embeds/pushIndirect.asm
+var pushIndirectAsm string
+
+//go:embed embeds/popIndirect.asm
+var popIndirectAsm string
+
+//go:embed embeds/runtimeCall.asm
+var runtimeCallAsm string
+
+//go:embed embeds/mul.asm
+var mulAsm string
+
+//go:embed embeds/div.asm
+var divAsm string
+
+//go:embed embeds/shr.asm
+var shrAsm string
+
+//go:embed embeds/stackCheck.asm
+var stackCheckAsm string
+
+//go:embed embeds/fatal.asm
+var fatalAsm string
+
+//go:embed embeds/count.asm
+var countAsm string
+
+//go:embed embeds/pushFrame.asm
+var pushFrameAsm string
+
+//go:embed embeds/tailcallJump.asm
+var tailcallJumpAsm string
+
+//go:embed embeds/tailcall.asm
+var tailcallAsm string
+
+var segmentMapping map[string]string = map[string]string{
+	"argument": "ARG",
+	"local":    "LCL",
+	"this":     "THIS",
+	"that":     "THAT",
+	"temp":     "TEMP",
+	"static":   "LCL",
+	"constant": "LCL",
+	"pointer":  "LCL",
+}
+
+var indirectSegmentMapping map[string]string = map[string]string{
+	"argument-indirect": "ARG",
+	"local-indirect":    "LCL",
+	"this-indirect":     "THIS",
+	"that-indirect":     "THAT",
+}
+
+// runtime routines shared by the extended commands, emitted once after the
+// end loop if any call site needs them
+var runtimeRoutines []string = []string{"mul", "div", "shr", "tailcall"}
+
+var runtimeAsm map[string]string = map[string]string{
+	"mul":      mulAsm,
+	"div":      divAsm,
+	"shr":      shrAsm,
+	"tailcall": tailcallAsm,
+}
+
+var runtimeLabels map[string]string = map[string]string{
+	"mul": "VM$MUL",
+	"div": "VM$DIV",
+	"shr": "VM$SHR",
+}
+
+// the words above SP a runtime routine uses as scratch
+var scratchWords map[string]int = map[string]int{
+	"div": 2,
+	"shr": 1,
+}
+
+var mathFallback map[string]string = map[string]string{
+	"mul": "Math.multiply",
+	"div": "Math.divide",
+	"shr": "Math.divide",
+}
+
+type Options struct {
+	// lower mul, div and shr to calls into the Math class instead of the
+	// built-in runtime routines
+	MathFallback bool
+
+	// check SP against StackLimit on every push, call and function entry,
+	// and before div and shr, which use the words above the stack as
+	// scratch; on overflow the error code (100 push, div and shr, 101 call,
+	// 102 function) is stored in R15 and the program halts before anything
+	// is written past the limit
+	Checked    bool
+	StackLimit int
+
+	// count calls and returns of every function in two words per function
+	// starting at ProfileBase, which must leave them below the screen; the
+	// addresses are listed by WriteProfile
+	Profile     bool
+	ProfileBase int
+
+	// replace a call immediately followed by return with a jump that reuses
+	// the frame of the current function
+	TailCalls bool
+
+	// leave out the bootstrap code that sets SP and calls Sys.init, for
+	// programs that are started with the stack already set up
+	NoBootstrap bool
+}
+
+// the first address of the screen memory map, which the profile counters
+// must stay below
+const screenBase = 16384
+
+// the first address of the heap of the Jack OS
+const heapBase = 2048
+
+// ProfileBase returns the base address that puts the profile counters of the
+// functions of files at the top of the stack, right below the heap, where
+// neither the OS nor the program allocates memory. A stack that grows into
+// them overwrites them; in checked mode the stack limit keeps it below.
+func ProfileBase(files []parser.File) int {
+	functions := make(map[string]bool)
+	for _, file := range files {
+		for _, command := range file.Commands {
+			if command.Type == parser.C_FUNCTION {
+				functions[command.Arg1] = true
+			}
+		}
+	}
+
+	return heapBase - 2*len(functions)
+}
+
+// position is an entry of the source map: the first ROM address of the code
+// of a VM command and where the command comes from
+type position struct {
+	address  int
+	fileName string
+	line     int
+	source   string
+}
+
+type CodeWriter struct {
+	writer    *bufio.Writer
+	id        map[string]int
+	fileName  string
+	function  string
+	options   Options
+	runtime   map[string]bool
+	counters  map[string]int
+	profile   []string
+	address   int
+	source    string
+	positions []position
+	buffer    *bytes.Buffer
+}
+
+func NewCodeWriter(w io.Writer, options Options) *CodeWriter {
+	writer := bufio.NewWriter(w)
+	id := make(map[string]int)
+
+	c := CodeWriter{
+		writer:   writer,
+		id:       id,
+		options:  options,
+		runtime:  make(map[string]bool),
+		counters: make(map[string]int),
+	}
+
+	if !options.NoBootstrap {
+		c.write(initAsm)
+		c.Call("Sys.init", 0)
+	}
+
+	return &c
+}
+
+func (c *CodeWriter) SetFileName(fileName string) {
+	c.fileName = fileName
+}
+
+// Annotate records the origin of the next command for the source map and
+// writes the Jack source position, when it changes, and the comment of the
+// command as assembly comments.
+func (c *CodeWriter) Annotate(fileName string, line int, source, comment string) {
+	if source != "" && source != c.source {
+		c.write(fmt.Sprintf("// @line %s\n", source))
+	}
+	c.source = source
+
+	if comment != "" {
+		c.write(fmt.Sprintf("// %s\n", comment))
+	}
+
+	c.positions = append(c.positions, position{c.address, fileName, line, c.source})
+}
+
+func (c *CodeWriter) Arithmetic(command string) error {
+	output := ""
+	comment := fmt.Sprintf("// %s\n", command)
+
+	switch command {
+	case "add":
+		output = comment + popDAsm + fetchMAsm + "M=M+D\n"
+
+	case "sub":
+		output = comment + popDAsm + fetchMAsm + "M=M-D\n"
+
+	case "and":
+		output = comment + popDAsm + fetchMAsm + "M=M&D\n"
+
+	case "or":
+		output = comment + popDAsm + fetchMAsm + "M=M|D\n"
+
+	case "neg":
+		output = comment + fetchMAsm + "M=-M\n"
+
+	case "not":
+		output = comment + fetchMAsm + "M=!M\n"
+
+	case "eq", "gt", "lt", "le", "ge", "ne":
+		output = comment + popDAsm + fetchMAsm + fmt.Sprintf(conditionalAsm, strings.ToUpper(command), c.getLabel(command))
+
+	case "xor":
+		output = comment + xorAsm
+
+	case "shl":
+		output = comment + shlAsm
+
+	case "mul", "div", "shr":
+		if c.options.MathFallback {
+			c.write(comment)
+			if command == "shr" {
+				c.PushPop("push", "constant", 2)
+			}
+			return c.Call(mathFallback[command], 2)
+		}
+
+		c.runtime[command] = true
+		output = comment
+
+		// div keeps its sign and bit counter in the two words above the
+		// stack and shr its bit mask in the first, which must not cross the
+		// limit either
+		if c.options.Checked && scratchWords[command] > 0 {
+			output += c.getStackCheck(scratchWords[command], "VM$OVERFLOW_PUSH")
+		}
+
+		output += fmt.Sprintf(runtimeCallAsm, runtimeLabels[command], c.getLabel(command))
+
+	default:
+		return fmt.Errorf("unknown arithmetic command: %s", command)
+	}
+
+	c.write(output)
+	return nil
+}
+
+func (c *CodeWriter) PushPop(command, segment string, index int) error {
+	output := ""
+	comment := fmt.Sprintf("// %s %s %d\n", command, segment, index)
+
+	if v, ok := indirectSegmentMapping[segment]; ok {
+		comment = fmt.Sprintf("// %s %s\n", command, segment)
+
+		switch command {
+		case "push":
+			output = comment + fmt.Sprintf(pushIndirectAsm, v)
+		case "pop":
+			output = comment + fmt.Sprintf(popIndirectAsm, v)
+		}
+
+		c.write(output)
+		return nil
+	}
+
+	var code string
+
+	switch segment {
+	case "pointer":
+		code = c.getPointer(command, index)
+	case "temp":
+		code = c.getTemp(command, index)
+	case "constant":
+		code = c.getConstant(command, index)
+	case "static":
+		code = c.getStatic(command, index)
+	default:
+		code = c.getDefaultPushPop(command, segment, index)
+	}
+
+	if code == "" {
+		return fmt.Errorf("invalid command: %s %s %d", command, segment, index)
+	}
+
+	output = comment
+
+	// checked before the push, so that the word at the limit is never
+	// overwritten
+	if c.options.Checked && command == "push" {
+		output += c.getStackCheck(1, "VM$OVERFLOW_PUSH")
+	}
+
+	output += code
+
+	c.write(output)
+	return nil
+}
+
+func (c *CodeWriter) Label(label string) error {
+	comment := fmt.Sprintf("// label %s\n", label)
+
+	if c.function != "" {
+		label = c.function + "$" + label
+	}
+
+	output := fmt.Sprintf("(%s)\n", label)
+	c.write(comment + output)
+	return nil
+}
+
+func (c *CodeWriter) Goto(label string) error {
+	comment := fmt.Sprintf("// goto %s\n", label)
+
+	if c.function != "" {
+		label = c.function + "$" + label
+	}
+
+	output := fmt.Sprintf(gotoAsm, label)
+	c.write(comment + output)
+	return nil
+}
+
+func (c *CodeWriter) If(label string) error {
+	comment := fmt.Sprintf("// if-goto %s\n", label)
+
+	if c.function != "" {
+		label = c.function + "$" + label
+	}
+
+	output := popDAsm + fmt.Sprintf(ifgotoAsm, label)
+	c.write(comment + output)
+	return nil
+}
+
+func (c *CodeWriter) Function(label string, nVars int) error {
+	comment := fmt.Sprintf("// function %s %d\n", label, nVars)
+	prologue := ""
+	if c.options.Checked {
+		prologue += c.getStackCheck(nVars, "VM$OVERFLOW_FUNCTION")
+	}
+	if c.options.Profile {
+		counter, err := c.getCounter(label)
+		if err != nil {
+			return err
+		}
+		prologue += fmt.Sprintf(countAsm, counter)
+	}
+
+	output := fmt.Sprintf(functionAsm, label, nVars, prologue)
+
+	c.write(comment + output)
+	c.function = label
+	return nil
+}
+
+func (c *CodeWriter) Call(label string, nArgs int) error {
+	comment := fmt.Sprintf("// call %s %d\n", label, nArgs)
+	scope := c.scope()
+	returnAddress := fmt.Sprintf("%s$ret%d", scope, c.getId(scope+"$ret"))
+	output := ""
+
+	if c.options.Checked {
+		output += c.getStackCheck(5, "VM$OVERFLOW_CALL")
+	}
+
+	output += fmt.Sprintf(pushAddressAsm, returnAddress) +
+		fmt.Sprintf(pushSymbolAsm, "LCL") +
+		fmt.Sprintf(pushSymbolAsm, "ARG") +
+		fmt.Sprintf(pushSymbolAsm, "THIS") +
+		fmt.Sprintf(pushSymbolAsm, "THAT") +
+		fmt.Sprintf(callAsm, label, nArgs, returnAddress)
+	c.write(comment + output)
+	return nil
+}
+
+// TailCall writes a call immediately followed by return. The saved frame of
+// the current function is pushed above the arguments and both are moved down
+// to ARG, so the callee returns straight to the caller of the current
+// function and the stack does not grow.
+func (c *CodeWriter) TailCall(label string, nArgs int) error {
+	if !c.options.TailCalls || c.function == "" {
+		if err := c.Call(label, nArgs); err != nil {
+			return err
+		}
+		return c.Return()
+	}
+
+	comment := fmt.Sprintf("// call %s %d\n// return\n", label, nArgs)
+	output := ""
+
+	if c.options.Checked {
+		output += c.getStackCheck(5, "VM$OVERFLOW_CALL")
+	}
+
+	// the current function returns through the callee, so it is counted as
+	// returned here
+	if c.options.Profile {
+		counter, err := c.getCounter(c.function)
+		if err != nil {
+			return err
+		}
+		output += fmt.Sprintf(countAsm, counter+1)
+	}
+
+	for i := 5; i >= 1; i-- {
+		output += fmt.Sprintf(pushFrameAsm, i)
+	}
+
+	c.runtime["tailcall"] = true
+	output += fmt.Sprintf(tailcallJumpAsm, label, nArgs+5)
+	c.write(comment + output)
+	return nil
+}
+
+func (c *CodeWriter) Return() error {
+	comment := fmt.Sprintf("// return\n")
+	output := returnAsm
+
+	if c.options.Profile && c.function != "" {
+		counter, err := c.getCounter(c.function)
+		if err != nil {
+			return err
+		}
+		output = fmt.Sprintf(countAsm, counter+1) + output
+	}
+
+	c.write(comment + output)
+	return nil
+}
+
+// Fork returns a CodeWriter for translating one file on its own, into a
+// buffer that Join appends to c. Profile counters are numbered in the order
+// the functions are seen, so Fork returns nil in profile mode.
+func (c *CodeWriter) Fork() backend.Backend {
+	if c.options.Profile {
+		return nil
+	}
+
+	var buffer bytes.Buffer
+	return &CodeWriter{
+		writer:   bufio.NewWriter(&buffer),
+		buffer:   &buffer,
+		id:       make(map[string]int),
+		options:  c.options,
+		runtime:  make(map[string]bool),
+		counters: make(map[string]int),
+	}
+}
+
+// Join appends the code of a CodeWriter returned by Fork, along with its
+// source map and the runtime routines it needs.
+func (c *CodeWriter) Join(b backend.Backend) error {
+	part, ok := b.(*CodeWriter)
+	if !ok || part.buffer == nil {
+		return errors.New("join of a code writer not returned by Fork")
+	}
+
+	if err := part.writer.Flush(); err != nil {
+		return err
+	}
+
+	for _, p := range part.positions {
+		p.address += c.address
+		c.positions = append(c.positions, p)
+	}
+	for routine := range part.runtime {
+		c.runtime[routine] = true
+	}
+
+	c.address += part.address
+	c.function = part.function
+	c.writer.Write(part.buffer.Bytes())
+	return nil
+}
+
+// Close writes the end loop and the shared routines and flushes the output.
+// It does not close the underlying writer.
+func (c *CodeWriter) Close() error {
+	c.write(endLoopAsm)
+
+	for _, routine := range runtimeRoutines {
+		if c.runtime[routine] {
+			c.write(runtimeAsm[routine])
+		}
+	}
+
+	if c.options.Checked {
+		c.write(fatalAsm)
+	}
+
+	return c.writer.Flush()
+}
+
+// WriteProfile lists the counter addresses of every function in profile mode,
+// one "name calls returns" line per function.
+func (c *CodeWriter) WriteProfile(w io.Writer) error {
+	writer := bufio.NewWriter(w)
+	for _, function := range c.profile {
+		address := c.counters[function]
+		fmt.Fprintf(writer, "%s %d %d\n", function, address, address+1)
+	}
+
+	return writer.Flush()
+}
+
+// WriteSourceMap lists the first ROM address of every annotated command, one
+// "address File.vm:line" line per command, followed by the Jack source
+// position if the command has one.
+func (c *CodeWriter) WriteSourceMap(w io.Writer) error {
+	writer := bufio.NewWriter(w)
+	for _, p := range c.positions {
+		if p.source == "" {
+			fmt.Fprintf(writer, "%d %s.vm:%d\n", p.address, p.fileName, p.line)
+		} else {
+			fmt.Fprintf(writer, "%d %s.vm:%d %s\n", p.address, p.fileName, p.line, p.source)
+		}
+	}
+
+	return writer.Flush()
+}
+
+// Address returns the ROM address of the next instruction written.
+func (c *CodeWriter) Address() int {
+	return c.address
+}
+
+// write errors are kept by the bufio.Writer and reported by Close
+func (c *CodeWriter) write(output string) {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "//") && !strings.HasPrefix(line, "(") {
+			c.address++
+		}
+	}
+
+	c.writer.WriteString(output)
+}
+
+func (c *CodeWriter) getId(key string) int {
+	id, ok := c.id[key]
+	if !ok {
+		c.id[key] = 0
+	}
+
+	c.id[key] = id + 1
+	return id
+}
+
+// returns the address of the call counter of function, the return counter
+// is the word after it
+func (c *CodeWriter) getCounter(function string) (int, error) {
+	address, ok := c.counters[function]
+	if !ok {
+		address = c.options.ProfileBase + 2*len(c.profile)
+		if address+1 >= screenBase {
+			return 0, fmt.Errorf("no room for the profile counters of %s", function)
+		}
+
+		c.counters[function] = address
+		c.profile = append(c.profile, function)
+	}
+
+	return address, nil
+}
+
+// generated labels are namespaced by the current function, or by the file
+// outside of functions, so that files translated apart get distinct labels
+func (c *CodeWriter) scope() string {
+	if c.function != "" {
+		return c.function
+	}
+	return c.fileName
+}
+
+func (c *CodeWriter) getLabel(command string) string {
+	scope := c.scope()
+	label := fmt.Sprintf("%s_%d", strings.ToUpper(command), c.getId(scope+"$"+command))
+	if scope != "" {
+		label = scope + "$" + label
+	}
+
+	return label
+}
+
+// jumps to handler if pushing the given number of words would move SP past
+// the stack limit
+func (c *CodeWriter) getStackCheck(words int, handler string) string {
+	return fmt.Sprintf(stackCheckAsm, c.options.StackLimit-words, handler)
+}
+
+func (c *CodeWriter) getDefaultPushPop(command, segment string, index int) string {
+	var output string
+	v, ok := segmentMapping[segment]
+	if !ok {
+		return ""
+	}
+
+	switch command {
+	case "push":
+		output = fmt.Sprintf(pushAsm, v, index)
+	case "pop":
+		output = fmt.Sprintf(popAsm, v, index)
+	}
+
+	return output
+}
+
+func (c *CodeWriter) getPointer(command string, index int) string {
+	var output string
+
+	switch {
+	case command == "push" && index == 0:
+		output = fmt.Sprintf(pushSymbolAsm, "THIS")
+	case command == "push" && index == 1:
+		output = fmt.Sprintf(pushSymbolAsm, "THAT")
+	case command == "pop" && index == 0:
+		output = fmt.Sprintf(popSymbolAsm, "THIS")
+	case command == "pop" && index == 1:
+		output = fmt.Sprintf(popSymbolAsm, "THAT")
+	}
+
+	return output
+}
+
+func (c *CodeWriter) getTemp(command string, index int) string {
+	var output string
+
+	if index > 7 {
+		return ""
+	}
+
+	register := fmt.Sprintf("R%d", 5+index)
+
+	switch command {
+	case "push":
+		output = fmt.Sprintf(pushSymbolAsm, register)
+	case "pop":
+		output = fmt.Sprintf(popSymbolAsm, register)
+	}
+
+	return output
+}
+
+func (c *CodeWriter) getConstant(command string, index int) string {
+	var output string
+
+	switch command {
+	case "push":
+		output = fmt.Sprintf(pushConstantAsm, index)
+	}
+
+	return output
+}
+
+func (c *CodeWriter) getStatic(command string, index int) string {
+	var output string
+	v := c.fileName + "." + strconv.FormatInt(int64(index), 10)
+
+	switch command {
+	case "push":
+		output = fmt.Sprintf(pushSymbolAsm, v)
+	case "pop":
+		output = fmt.Sprintf(popSymbolAsm, v)
+	}
+
+	return output
+}
@@ -0,0 +1,443 @@
+package hack_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/pcjun97/JackVMTranslator/backend"
+	"github.com/pcjun97/JackVMTranslator/backend/hack"
+	"github.com/pcjun97/JackVMTranslator/cpu"
+	"github.com/pcjun97/JackVMTranslator/parser"
+)
+
+var setPattern *regexp.Regexp = regexp.MustCompile(`set\s+RAM\[(\d+)\]\s+(-?\d+)`)
+var repeatPattern *regexp.Regexp = regexp.MustCompile(`repeat\s+(\d+)`)
+var ramPattern *regexp.Regexp = regexp.MustCompile(`RAM\[(\d+)`)
+
+// the test programs of projects 7 and 8, each in testdata/<name> with the
+// .tst script and the .cmp file of the course; programs without Sys.init are
+// translated without bootstrap code
+var programs []string = []string{
+	"SimpleAdd",
+	"StackTest",
+	"BasicTest",
+	"PointerTest",
+	"StaticTest",
+	"BasicLoop",
+	"FibonacciSeries",
+	"SimpleFunction",
+	"NestedCall",
+	"FibonacciElement",
+	"StaticsTest",
+}
+
+func TestPrograms(t *testing.T) {
+	for _, name := range programs {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			dir := filepath.Join("testdata", name)
+
+			c := load(t, dir)
+			ticks := script(t, filepath.Join(dir, name+".tst"), c)
+
+			for i := 0; i < ticks && c.PC < c.Size(); i++ {
+				if err := c.Step(); err != nil {
+					t.Fatalf("ROM[%d]: %v", c.PC, err)
+				}
+			}
+
+			for address, want := range expected(t, filepath.Join(dir, name+".cmp")) {
+				if got := c.RAM[address]; got != want {
+					t.Errorf("RAM[%d] = %d, want %d", address, got, want)
+				}
+			}
+		})
+	}
+}
+
+// translates the files of every program both one after another and
+// concurrently, which must give the same code and source map
+func TestTranslateFiles(t *testing.T) {
+	for _, name := range programs {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			dir := filepath.Join("testdata", name)
+
+			asm, sourceMap := translate(t, dir, 1)
+			parallelAsm, parallelSourceMap := translate(t, dir, 4)
+
+			if !bytes.Equal(asm, parallelAsm) {
+				t.Error("concurrent translation differs in code")
+			}
+			if !bytes.Equal(sourceMap, parallelSourceMap) {
+				t.Error("concurrent translation differs in source map")
+			}
+		})
+	}
+}
+
+// pushes past the stack limit in checked mode, which must halt before the
+// word at the limit is written
+func TestCheckedPushOverflow(t *testing.T) {
+	const limit = 260
+
+	c := execute(t, strings.Repeat("push constant 7\n", 10), hack.Options{Checked: true, StackLimit: limit})
+
+	if got := c.RAM[15]; got != 100 {
+		t.Errorf("error code = %d, want 100", got)
+	}
+	if got := c.RAM[0]; got != limit {
+		t.Errorf("SP = %d, want %d", got, limit)
+	}
+	if got := c.RAM[limit]; got != 0 {
+		t.Errorf("RAM[%d] = %d, want it untouched", limit, got)
+	}
+}
+
+// the counters of a function that returns through a tail call, which must
+// count the return as if it returned itself
+func TestProfileTailCall(t *testing.T) {
+	const base = 2000
+
+	source := `function Sys.init 0
+call Sys.f 0
+pop temp 0
+label END
+goto END
+function Sys.f 0
+call Sys.g 0
+return
+function Sys.g 0
+push constant 1
+return
+`
+	c := execute(t, source, hack.Options{Profile: true, ProfileBase: base, TailCalls: true})
+
+	// Sys.init, which never returns, has the first two counters
+	for i, function := range []string{"Sys.f", "Sys.g"} {
+		calls, returns := c.RAM[base+2*i+2], c.RAM[base+2*i+3]
+		if calls != 1 || returns != 1 {
+			t.Errorf("%s: %d calls, %d returns, want 1 and 1", function, calls, returns)
+		}
+	}
+}
+
+// the commands of the extended instruction set on two operands, with the
+// results of the VM emulator; mul and div run the VM$MUL and VM$DIV routines
+var binaryTests []struct {
+	command string
+	x, y    int16
+	want    int16
+} = []struct {
+	command string
+	x, y    int16
+	want    int16
+}{
+	{"mul", 3, 4, 12},
+	{"mul", -3, 4, -12},
+	{"mul", -3, -4, 12},
+	{"mul", 0, 5, 0},
+	{"mul", 300, 300, 24464},
+	{"mul", 32767, 2, -2},
+	{"mul", -32768, -1, -32768},
+	{"mul", -32768, 3, -32768},
+
+	{"div", 7, 2, 3},
+	{"div", -7, 2, -3},
+	{"div", 7, -2, -3},
+	{"div", -7, -2, 3},
+	{"div", 100, 7, 14},
+	{"div", 0, 5, 0},
+	{"div", 1, 2, 0},
+	{"div", 32767, 1, 32767},
+	{"div", 32767, -32768, 0},
+	{"div", -32768, 1, -32768},
+	{"div", -32768, 2, -16384},
+	{"div", -32768, -1, -32768},
+	{"div", -32768, -32768, 1},
+	{"div", -32767, -32768, 0},
+
+	{"xor", 12, 10, 6},
+	{"xor", -1, 5, -6},
+	{"xor", -32768, -1, 32767},
+
+	{"le", 2, 3, -1},
+	{"le", 3, 3, -1},
+	{"le", 4, 3, 0},
+	{"le", -5, 3, -1},
+	{"ge", 2, 3, 0},
+	{"ge", 3, 3, -1},
+	{"ge", -3, -5, -1},
+	{"ne", 3, 3, 0},
+	{"ne", 3, -3, -1},
+	{"ne", -32768, -32768, 0},
+}
+
+func TestBinaryCommands(t *testing.T) {
+	for _, test := range binaryTests {
+		source := push(test.x) + push(test.y) + test.command + "\n"
+		c := execute(t, source, hack.Options{})
+
+		if got := c.RAM[0]; got != 257 {
+			t.Errorf("%d %s %d: SP = %d, want 257", test.x, test.command, test.y, got)
+		}
+		if got := c.RAM[256]; got != test.want {
+			t.Errorf("%d %s %d = %d, want %d", test.x, test.command, test.y, got, test.want)
+		}
+	}
+}
+
+// the commands of the extended instruction set on one operand; shr runs the
+// VM$SHR routine and rounds towards zero like the VM emulator
+var unaryTests []struct {
+	command string
+	x       int16
+	want    int16
+} = []struct {
+	command string
+	x       int16
+	want    int16
+}{
+	{"shr", 7, 3},
+	{"shr", -7, -3},
+	{"shr", -1, 0},
+	{"shr", 0, 0},
+	{"shr", 32767, 16383},
+	{"shr", -32768, -16384},
+	{"shr", -32767, -16383},
+	{"shl", 3, 6},
+	{"shl", -3, -6},
+	{"shl", 16384, -32768},
+	{"shl", -32768, 0},
+}
+
+func TestUnaryCommands(t *testing.T) {
+	for _, test := range unaryTests {
+		c := execute(t, push(test.x)+test.command+"\n", hack.Options{})
+
+		if got := c.RAM[0]; got != 257 {
+			t.Errorf("%s %d: SP = %d, want 257", test.command, test.x, got)
+		}
+		if got := c.RAM[256]; got != test.want {
+			t.Errorf("%s %d = %d, want %d", test.command, test.x, got, test.want)
+		}
+	}
+}
+
+// push and pop through the indirect segments, with the offset on the stack
+func TestIndirectSegments(t *testing.T) {
+	for segment, base := range map[string]int{
+		"local-indirect":    1,
+		"argument-indirect": 2,
+		"this-indirect":     3,
+		"that-indirect":     4,
+	} {
+		source := "push constant 3\n" +
+			"push constant 42\n" +
+			"pop " + segment + "\n" +
+			"push constant 3\n" +
+			"push " + segment + "\n"
+		c := execute(t, source, hack.Options{}, base, 1000)
+
+		if got := c.RAM[1003]; got != 42 {
+			t.Errorf("%s: RAM[1003] = %d, want 42", segment, got)
+		}
+		if got := c.RAM[0]; got != 257 {
+			t.Errorf("%s: SP = %d, want 257", segment, got)
+		}
+		if got := c.RAM[256]; got != 42 {
+			t.Errorf("%s: pushed %d, want 42", segment, got)
+		}
+	}
+}
+
+// div and shr right at the stack limit in checked mode, which must halt
+// before their scratch words past the limit are written
+func TestCheckedScratchOverflow(t *testing.T) {
+	const limit = 258
+
+	for _, command := range []string{"div", "shr"} {
+		c := execute(t, "push constant 9\npush constant 2\n"+command+"\n", hack.Options{Checked: true, StackLimit: limit})
+
+		if got := c.RAM[15]; got != 100 {
+			t.Errorf("%s: error code = %d, want 100", command, got)
+		}
+		for address := limit; address < limit+2; address++ {
+			if got := c.RAM[address]; got != 0 {
+				t.Errorf("%s: RAM[%d] = %d, want it untouched", command, address, got)
+			}
+		}
+	}
+
+	c := execute(t, "push constant 9\npush constant 2\ndiv\n", hack.Options{Checked: true, StackLimit: limit + 2})
+	if got := c.RAM[0]; got != 257 {
+		t.Errorf("9 div 2 below the limit: SP = %d, want 257", got)
+	}
+	if got := c.RAM[256]; got != 4 {
+		t.Errorf("9 div 2 below the limit = %d, want 4", got)
+	}
+}
+
+// returns the commands that push value, which push constant cannot do for
+// negative values
+func push(value int16) string {
+	switch {
+	case value == -32768:
+		return "push constant 32767\nnot\n"
+	case value < 0:
+		return fmt.Sprintf("push constant %d\nneg\n", -value)
+	}
+	return fmt.Sprintf("push constant %d\n", value)
+}
+
+// translates source in the extended instruction set without bootstrap code
+// and runs it with SP at 256 and the given address value pairs in RAM, until
+// it reaches the end loop
+func execute(t *testing.T, source string, options hack.Options, ram ...int) *cpu.CPU {
+	t.Helper()
+
+	commands, err := parser.Parse(strings.NewReader(source), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var asm bytes.Buffer
+	options.NoBootstrap = true
+	w := hack.NewCodeWriter(&asm, options)
+	if err := backend.Translate(w, "Main", commands); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := cpu.Load(bytes.NewReader(asm.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.RAM[0] = 256
+	for i := 0; i+1 < len(ram); i += 2 {
+		c.RAM[ram[i]] = int16(ram[i+1])
+	}
+
+	for i := 0; i < 100000 && c.PC < c.Size(); i++ {
+		if err := c.Step(); err != nil {
+			t.Fatalf("ROM[%d]: %v", c.PC, err)
+		}
+	}
+
+	return c
+}
+
+// translates every .vm file of dir and assembles the result
+func load(t *testing.T, dir string) *cpu.CPU {
+	asm, _ := translate(t, dir, 1)
+
+	c, err := cpu.Load(bytes.NewReader(asm))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+// translates every .vm file of dir with up to workers files at once and
+// returns the code and the source map
+func translate(t *testing.T, dir string, workers int) ([]byte, []byte) {
+	files, err := parser.ReadFiles(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bootstrap := false
+	for _, file := range files {
+		for _, command := range file.Commands {
+			if command.Type == parser.C_FUNCTION && command.Arg1 == "Sys.init" {
+				bootstrap = true
+			}
+		}
+	}
+
+	var asm, sourceMap bytes.Buffer
+	w := hack.NewCodeWriter(&asm, hack.Options{NoBootstrap: !bootstrap})
+
+	if err := backend.TranslateFiles(w, files, workers); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.WriteSourceMap(&sourceMap); err != nil {
+		t.Fatal(err)
+	}
+
+	return asm.Bytes(), sourceMap.Bytes()
+}
+
+// applies the set RAM commands of a test script and returns its number of
+// ticks
+func script(t *testing.T, file string, c *cpu.CPU) int {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, match := range setPattern.FindAllStringSubmatch(string(content), -1) {
+		address, _ := strconv.Atoi(match[1])
+		value, _ := strconv.Atoi(match[2])
+		c.RAM[address] = int16(value)
+	}
+
+	match := repeatPattern.FindStringSubmatch(string(content))
+	if match == nil {
+		t.Fatalf("%s: no repeat command", file)
+	}
+
+	ticks, _ := strconv.Atoi(match[1])
+	return ticks
+}
+
+// reads the expected RAM values from the header and the value row of a
+// compare file
+func expected(t *testing.T, file string) map[int]int16 {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("%s: expected a header and a value row", file)
+	}
+
+	header := strings.Split(strings.Trim(lines[0], "|"), "|")
+	row := strings.Split(strings.Trim(lines[1], "|"), "|")
+	if len(header) != len(row) {
+		t.Fatalf("%s: header and value row differ in length", file)
+	}
+
+	values := make(map[int]int16)
+	for i, cell := range header {
+		match := ramPattern.FindStringSubmatch(cell)
+		if match == nil {
+			t.Fatalf("%s: unknown column %s", file, cell)
+		}
+
+		address, _ := strconv.Atoi(match[1])
+		value, err := strconv.Atoi(strings.TrimSpace(row[i]))
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		values[address] = int16(value)
+	}
+
+	return values
+}
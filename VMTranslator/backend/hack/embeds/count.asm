@@ -0,0 +1,2 @@
+@%d
+M=M+1
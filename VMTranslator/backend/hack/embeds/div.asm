@@ -0,0 +1,98 @@
+(VM$DIV)
+@SP
+A=M
+M=0
+@SP
+A=M-1
+D=M
+@VM$DIV_Y_POS
+D;JGE
+@SP
+A=M-1
+M=-D
+@SP
+A=M
+M=!M
+(VM$DIV_Y_POS)
+@SP
+A=M-1
+A=A-1
+D=M
+@VM$DIV_X_POS
+D;JGE
+@SP
+A=M-1
+A=A-1
+M=-D
+@SP
+A=M
+M=!M
+(VM$DIV_X_POS)
+@R13
+M=0
+@R14
+M=0
+@16
+D=A
+@SP
+A=M+1
+M=D
+(VM$DIV_LOOP)
+@R13
+D=M
+M=D+M
+@SP
+A=M-1
+A=A-1
+D=M
+M=D+M
+@VM$DIV_NO_BIT
+D;JGE
+@R13
+M=M+1
+(VM$DIV_NO_BIT)
+@R14
+D=M
+M=D+M
+@R13
+D=M
+@VM$DIV_SUBTRACT
+D;JLT
+@SP
+A=M-1
+D=M
+@R13
+D=M-D
+@VM$DIV_NEXT
+D;JLT
+(VM$DIV_SUBTRACT)
+@SP
+A=M-1
+D=M
+@R13
+M=M-D
+@R14
+M=M+1
+(VM$DIV_NEXT)
+@SP
+A=M+1
+MD=M-1
+@VM$DIV_LOOP
+D;JGT
+@SP
+A=M
+D=M
+@VM$DIV_POS
+D;JEQ
+@R14
+M=-M
+(VM$DIV_POS)
+@R14
+D=M
+@SP
+AM=M-1
+A=A-1
+M=D
+@R15
+A=M
+0;JMP
@@ -0,0 +1,21 @@
+(VM$OVERFLOW_PUSH)
+@100
+D=A
+@VM$FATAL
+0;JMP
+(VM$OVERFLOW_CALL)
+@101
+D=A
+@VM$FATAL
+0;JMP
+(VM$OVERFLOW_FUNCTION)
+@102
+D=A
+@VM$FATAL
+0;JMP
+(VM$FATAL)
+@R15
+M=D
+(VM$FATAL_LOOP)
+@VM$FATAL_LOOP
+0;JMP
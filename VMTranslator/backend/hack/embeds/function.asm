@@ -1,5 +1,5 @@
 (%[1]s)
-@%[2]d
+%[3]s@%[2]d
 D=A
 @%[1]s$INIT_END
 D;JLE
@@ -0,0 +1,39 @@
+(VM$MUL)
+@R13
+M=0
+@R14
+M=1
+(VM$MUL_LOOP)
+@SP
+A=M-1
+D=M
+@R14
+D=D&M
+@VM$MUL_NEXT
+D;JEQ
+@SP
+A=M-1
+A=A-1
+D=M
+@R13
+M=D+M
+(VM$MUL_NEXT)
+@SP
+A=M-1
+A=A-1
+D=M
+M=D+M
+@R14
+D=M
+MD=D+M
+@VM$MUL_LOOP
+D;JNE
+@R13
+D=M
+@SP
+AM=M-1
+A=A-1
+M=D
+@R15
+A=M
+0;JMP
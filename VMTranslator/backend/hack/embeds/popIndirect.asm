@@ -0,0 +1,17 @@
+@SP
+AM=M-1
+D=M
+@R13
+M=D
+@SP
+AM=M-1
+D=M
+@%s
+D=D+M
+@R14
+M=D
+@R13
+D=M
+@R14
+A=M
+M=D
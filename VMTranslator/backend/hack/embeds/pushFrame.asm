@@ -0,0 +1,10 @@
+@LCL
+D=M
+@%d
+A=D-A
+D=M
+@SP
+A=M
+M=D
+@SP
+M=M+1
@@ -0,0 +1,9 @@
+@%s
+D=M
+@SP
+A=M-1
+A=D+M
+D=M
+@SP
+A=M-1
+M=D
@@ -0,0 +1,7 @@
+@%[2]s
+D=A
+@R15
+M=D
+@%[1]s
+0;JMP
+(%[2]s)
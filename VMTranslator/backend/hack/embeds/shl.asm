@@ -0,0 +1,4 @@
+@SP
+A=M-1
+D=M
+M=D+M
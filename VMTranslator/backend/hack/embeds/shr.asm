@@ -0,0 +1,53 @@
+(VM$SHR)
+@SP
+A=M-1
+D=M
+@VM$SHR_POS
+D;JGE
+D=D+1
+(VM$SHR_POS)
+@R13
+M=D
+@R14
+M=0
+@SP
+A=M
+M=1
+(VM$SHR_LOOP)
+@SP
+A=M
+D=M
+D=D+M
+@R13
+D=D&M
+@VM$SHR_SKIP
+D;JEQ
+@SP
+A=M
+D=M
+@R14
+M=D+M
+(VM$SHR_SKIP)
+@SP
+A=M
+D=M
+MD=D+M
+@VM$SHR_LOOP
+D;JGT
+@R13
+D=M
+@VM$SHR_END
+D;JGE
+@32767
+D=!A
+@R14
+M=D|M
+(VM$SHR_END)
+@R14
+D=M
+@SP
+A=M-1
+M=D
+@R15
+A=M
+0;JMP
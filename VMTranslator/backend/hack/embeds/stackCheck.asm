@@ -0,0 +1,6 @@
+@SP
+D=M
+@%[1]d
+D=D-A
+@%[2]s
+D;JGT
@@ -0,0 +1,27 @@
+(VM$TAILCALL)
+@R14
+D=M
+@SP
+D=D-M
+@VM$TAILCALL_END
+D;JGE
+@R14
+M=M+1
+A=M-1
+D=M
+@R13
+M=M+1
+A=M-1
+M=D
+@VM$TAILCALL
+0;JMP
+(VM$TAILCALL_END)
+@R13
+D=M
+@LCL
+M=D
+@SP
+M=D
+@R15
+A=M
+0;JMP
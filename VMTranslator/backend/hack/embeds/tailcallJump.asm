@@ -0,0 +1,16 @@
+@ARG
+D=M
+@R13
+M=D
+@SP
+D=M
+@%[2]d
+D=D-A
+@R14
+M=D
+@%[1]s
+D=A
+@R15
+M=D
+@VM$TAILCALL
+0;JMP
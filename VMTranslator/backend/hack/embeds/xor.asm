@@ -0,0 +1,20 @@
+@SP
+AM=M-1
+D=M
+@R13
+M=D
+@SP
+A=M-1
+D=D&M
+@R14
+M=!D
+@R13
+D=M
+@SP
+A=M-1
+D=D|M
+@R14
+D=D&M
+@SP
+A=M-1
+M=D
@@ -0,0 +1,10 @@
+load FibonacciElement.asm,
+output-file FibonacciElement.out,
+compare-to FibonacciElement.cmp,
+output-list RAM[0]%D1.6.2 RAM[261]%D1.6.2;
+
+repeat 6000 {
+  ticktock;
+}
+
+output;
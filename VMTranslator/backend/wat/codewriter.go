@@ -0,0 +1,360 @@
+package wat
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	_ "embed"
+)
+
+//go:embed embeds/header.wat
+var headerWat string
+
+var segmentBase map[string]int = map[string]int{
+	"local":    1,
+	"argument": 2,
+	"this":     3,
+	"that":     4,
+}
+
+var indirectBase map[string]int = map[string]int{
+	"local-indirect":    1,
+	"argument-indirect": 2,
+	"this-indirect":     3,
+	"that-indirect":     4,
+}
+
+var segmentSize map[string]int = map[string]int{
+	"pointer": 2,
+	"temp":    8,
+}
+
+var segmentFixed map[string]int = map[string]int{
+	"pointer": 3,
+	"temp":    5,
+}
+
+var binaryOperators map[string]string = map[string]string{
+	"add": "i32.add",
+	"sub": "i32.sub",
+	"and": "i32.and",
+	"or":  "i32.or",
+	"xor": "i32.xor",
+	"mul": "i32.mul",
+	"div": "i32.div_s",
+}
+
+var comparisonOperators map[string]string = map[string]string{
+	"eq": "i32.eq",
+	"gt": "i32.gt_s",
+	"lt": "i32.lt_s",
+	"le": "i32.le_s",
+	"ge": "i32.ge_s",
+	"ne": "i32.ne",
+}
+
+var unaryOperators map[string]string = map[string]string{
+	"neg": "local.set $t\n\ti32.const 0\n\tlocal.get $t\n\ti32.sub",
+	"not": "i32.const -1\n\ti32.xor",
+	"shl": "i32.const 1\n\ti32.shl",
+	"shr": "i32.const 2\n\ti32.div_s",
+}
+
+var labelReference *regexp.Regexp = regexp.MustCompile(`\{[^}]*\}`)
+
+var errNoFunction error = errors.New("commands outside of a function are not supported by the wat target")
+
+type function struct {
+	name     string
+	sections []*strings.Builder
+	labels   map[string]int
+}
+
+// CodeWriter translates VM commands into a WebAssembly text module. Hack RAM
+// is the first 64K of linear memory, one 16-bit word per address, and every
+// VM function becomes a wasm function that keeps the VM stack and frame in
+// that memory. Goto and if-goto jump between the sections of a function
+// through a br_table dispatch loop.
+type CodeWriter struct {
+	writer   *bufio.Writer
+	fileName string
+	function *function
+	called   []string
+	defined  map[string]bool
+	statics  map[string]int
+}
+
+func NewCodeWriter(w io.Writer) *CodeWriter {
+	c := CodeWriter{
+		writer:  bufio.NewWriter(w),
+		defined: make(map[string]bool),
+		statics: make(map[string]int),
+	}
+
+	c.writer.WriteString(headerWat)
+
+	return &c
+}
+
+func (c *CodeWriter) SetFileName(fileName string) {
+	c.fileName = fileName
+}
+
+func (c *CodeWriter) Arithmetic(command string) error {
+	if c.function == nil {
+		return errNoFunction
+	}
+
+	if operator, ok := binaryOperators[command]; ok {
+		c.write(fmt.Sprintf(";; %s\n\tcall $hack/pop\n\tlocal.set $t\n\tcall $hack/pop\n\tlocal.get $t\n\t%s\n\tcall $hack/push", command, operator))
+		return nil
+	}
+
+	if operator, ok := comparisonOperators[command]; ok {
+		c.write(fmt.Sprintf(";; %s\n\tcall $hack/pop\n\tlocal.set $t\n\tcall $hack/pop\n\tlocal.get $t\n\t%s\n\tlocal.set $t\n\ti32.const 0\n\tlocal.get $t\n\ti32.sub\n\tcall $hack/push", command, operator))
+		return nil
+	}
+
+	if operator, ok := unaryOperators[command]; ok {
+		c.write(fmt.Sprintf(";; %s\n\tcall $hack/pop\n\t%s\n\tcall $hack/push", command, operator))
+		return nil
+	}
+
+	return fmt.Errorf("unknown arithmetic command: %s", command)
+}
+
+func (c *CodeWriter) PushPop(command, segment string, index int) error {
+	if c.function == nil {
+		return errNoFunction
+	}
+
+	if base, ok := indirectBase[segment]; ok {
+		switch command {
+		case "push":
+			c.write(fmt.Sprintf(";; push %s\n\ti32.const %d\n\tcall $hack/peek\n\tcall $hack/pop\n\ti32.add\n\tcall $hack/peek\n\tcall $hack/push", segment, base))
+		case "pop":
+			c.write(fmt.Sprintf(";; pop %s\n\tcall $hack/pop\n\tlocal.set $t\n\ti32.const %d\n\tcall $hack/peek\n\tcall $hack/pop\n\ti32.add\n\tlocal.get $t\n\tcall $hack/poke", segment, base))
+		}
+
+		return nil
+	}
+
+	if segment == "constant" {
+		if command != "push" {
+			return fmt.Errorf("invalid command: %s constant %d", command, index)
+		}
+
+		c.write(fmt.Sprintf(";; push constant %d\n\ti32.const %d\n\tcall $hack/push", index, index))
+		return nil
+	}
+
+	address, err := c.getAddress(segment, index)
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "push":
+		c.write(fmt.Sprintf(";; push %s %d\n\t%s\n\tcall $hack/peek\n\tcall $hack/push", segment, index, address))
+	case "pop":
+		c.write(fmt.Sprintf(";; pop %s %d\n\t%s\n\tcall $hack/pop\n\tcall $hack/poke", segment, index, address))
+	}
+
+	return nil
+}
+
+func (c *CodeWriter) Label(label string) error {
+	if c.function == nil {
+		return errNoFunction
+	}
+
+	if _, ok := c.function.labels[label]; ok {
+		return fmt.Errorf("label %s already defined", label)
+	}
+
+	c.function.labels[label] = len(c.function.sections)
+	c.function.sections = append(c.function.sections, &strings.Builder{})
+	c.write(fmt.Sprintf(";; label %s", label))
+
+	return nil
+}
+
+func (c *CodeWriter) Goto(label string) error {
+	if c.function == nil {
+		return errNoFunction
+	}
+
+	c.write(fmt.Sprintf(";; goto %s\n\t%s\n\tlocal.set $pc\n\tbr $dispatch", label, c.getLabel(label)))
+	return nil
+}
+
+func (c *CodeWriter) If(label string) error {
+	if c.function == nil {
+		return errNoFunction
+	}
+
+	c.write(fmt.Sprintf(";; if-goto %s\n\tcall $hack/pop\n\tif\n\t%s\n\tlocal.set $pc\n\tbr $dispatch\n\tend", label, c.getLabel(label)))
+	return nil
+}
+
+func (c *CodeWriter) Function(name string, nVars int) error {
+	if c.defined[name] {
+		return fmt.Errorf("function %s already defined", name)
+	}
+
+	if err := c.flushFunction(); err != nil {
+		return err
+	}
+
+	c.defined[name] = true
+	c.function = &function{
+		name:     name,
+		sections: []*strings.Builder{{}},
+		labels:   make(map[string]int),
+	}
+
+	if name == "Sys.halt" {
+		c.write("call $hack/halt\n\tunreachable")
+	}
+
+	for i := 0; i < nVars; i++ {
+		c.write("i32.const 0\n\tcall $hack/push")
+	}
+
+	return nil
+}
+
+func (c *CodeWriter) Call(name string, nArgs int) error {
+	if c.function == nil {
+		return errNoFunction
+	}
+
+	c.called = append(c.called, name)
+	c.write(fmt.Sprintf(";; call %s %d\n\ti32.const %d\n\tcall $hack/call\n\tcall $%s", name, nArgs, nArgs, name))
+
+	return nil
+}
+
+func (c *CodeWriter) Return() error {
+	if c.function == nil {
+		return errNoFunction
+	}
+
+	c.write(";; return\n\tcall $hack/return\n\treturn")
+	return nil
+}
+
+// Close writes the remaining functions, stubs that trap for functions that
+// are called but never defined, and the exported main function.
+func (c *CodeWriter) Close() error {
+	if err := c.flushFunction(); err != nil {
+		return err
+	}
+
+	stubs := make(map[string]bool)
+	for _, name := range append(c.called, "Sys.init") {
+		if !c.defined[name] && !stubs[name] {
+			stubs[name] = true
+			fmt.Fprintf(c.writer, "\n(func $%s\n\tunreachable)\n", name)
+		}
+	}
+
+	c.writer.WriteString("\n(func (export \"main\")\n\ti32.const 0\n\ti32.const 256\n\tcall $hack/poke\n\ti32.const 0\n\tcall $hack/call\n\tcall $Sys.init)\n)\n")
+
+	return c.writer.Flush()
+}
+
+func (c *CodeWriter) write(output string) {
+	section := c.function.sections[len(c.function.sections)-1]
+	section.WriteString("\t")
+	section.WriteString(output)
+	section.WriteString("\n")
+}
+
+// writes the current function as nested blocks, one per section, entered
+// through a br_table on $pc
+func (c *CodeWriter) flushFunction() error {
+	f := c.function
+	if f == nil {
+		return nil
+	}
+
+	var err error
+	resolve := func(reference string) string {
+		label := reference[1 : len(reference)-1]
+		section, ok := f.labels[label]
+		if !ok && err == nil {
+			err = fmt.Errorf("%s: undefined label: %s", f.name, label)
+		}
+		return strconv.Itoa(section)
+	}
+
+	w := c.writer
+	fmt.Fprintf(w, "\n(func $%s\n\t(local $pc i32) (local $t i32)\n\tloop $dispatch\n", f.name)
+
+	for i := len(f.sections) - 1; i >= 0; i-- {
+		fmt.Fprintf(w, "\tblock $s%d\n", i)
+	}
+
+	w.WriteString("\tlocal.get $pc\n\tbr_table")
+	for i := range f.sections {
+		fmt.Fprintf(w, " $s%d", i)
+	}
+	w.WriteString("\n")
+
+	for i, section := range f.sections {
+		fmt.Fprintf(w, "\tend ;; $s%d\n", i)
+		w.WriteString(labelReference.ReplaceAllStringFunc(section.String(), resolve))
+	}
+
+	w.WriteString("\tend\n\tunreachable)\n")
+
+	c.function = nil
+	return err
+}
+
+// labels are resolved when the function is flushed, so a reference is
+// written as a {label} placeholder and replaced by its section there
+func (c *CodeWriter) getLabel(label string) string {
+	return "i32.const {" + label + "}"
+}
+
+// returns the instructions that leave the RAM address of a segment slot on
+// the wasm stack
+func (c *CodeWriter) getAddress(segment string, index int) (string, error) {
+	if base, ok := segmentBase[segment]; ok {
+		return fmt.Sprintf("i32.const %d\n\tcall $hack/peek\n\ti32.const %d\n\ti32.add", base, index), nil
+	}
+
+	if size, ok := segmentSize[segment]; ok {
+		if index >= size {
+			return "", fmt.Errorf("%s index out of range: %d", segment, index)
+		}
+		return fmt.Sprintf("i32.const %d", segmentFixed[segment]+index), nil
+	}
+
+	if segment == "static" {
+		return fmt.Sprintf("i32.const %d", c.getStatic(index)), nil
+	}
+
+	return "", fmt.Errorf("unknown segment: %s", segment)
+}
+
+// statics are allocated from address 16 in order of appearance, the same way
+// the Hack assembler allocates variables
+func (c *CodeWriter) getStatic(index int) int {
+	v := fmt.Sprintf("%s.%d", c.fileName, index)
+
+	address, ok := c.statics[v]
+	if !ok {
+		address = 16 + len(c.statics)
+		c.statics[v] = address
+	}
+
+	return address
+}
@@ -0,0 +1,92 @@
+package wat_test
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/pcjun97/JackVMTranslator/backend"
+	"github.com/pcjun97/JackVMTranslator/backend/wat"
+	"github.com/pcjun97/JackVMTranslator/parser"
+)
+
+var update *bool = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// programs of projects 7 and 8 made of functions only, which the wat target
+// requires, shared with the hack backend
+var programs []string = []string{
+	"SimpleFunction",
+	"FibonacciElement",
+	"StaticsTest",
+}
+
+// compares the module of every program with testdata/<name>.wat, which -update
+// rewrites after a deliberate change of the output
+func TestGolden(t *testing.T) {
+	for _, name := range programs {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			got := translate(t, filepath.Join("..", "hack", "testdata", name))
+			golden := filepath.Join("testdata", name+".wat")
+
+			if *update {
+				if err := os.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("output differs from %s", golden)
+			}
+		})
+	}
+}
+
+// assembles the module of every program with wat2wasm of the WebAssembly
+// Binary Toolkit, which checks that it is valid
+func TestValid(t *testing.T) {
+	wat2wasm, err := exec.LookPath("wat2wasm")
+	if err != nil {
+		t.Skip("wat2wasm not installed")
+	}
+
+	for _, name := range programs {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			source := filepath.Join(t.TempDir(), name+".wat")
+			if err := os.WriteFile(source, translate(t, filepath.Join("..", "hack", "testdata", name)), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			output, err := exec.Command(wat2wasm, "-o", os.DevNull, source).CombinedOutput()
+			if err != nil {
+				t.Errorf("%v\n%s", err, output)
+			}
+		})
+	}
+}
+
+func translate(t *testing.T, dir string) []byte {
+	files, err := parser.ReadFiles(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var module bytes.Buffer
+	w := wat.NewCodeWriter(&module)
+	if err := backend.TranslateFiles(w, files, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return module.Bytes()
+}
@@ -0,0 +1,281 @@
+;; Generated by VMTranslator.
+
+(module
+
+;; host hooks: keyboard returns the current key code, screen is called after
+;; every store to the screen memory map, halt is called by Sys.halt
+(import "hack" "keyboard" (func $hack/keyboard (result i32)))
+(import "hack" "screen" (func $hack/screen (param $address i32) (param $value i32)))
+(import "hack" "halt" (func $hack/halt))
+
+;; Hack RAM, 32K 16-bit words
+(memory (export "memory") 1)
+
+(func $hack/peek (param $address i32) (result i32)
+	local.get $address
+	i32.const 32767
+	i32.and
+	i32.const 1
+	i32.shl
+	i32.load16_s)
+
+(func $hack/poke (param $address i32) (param $value i32)
+	local.get $address
+	i32.const 32767
+	i32.and
+	local.tee $address
+	i32.const 1
+	i32.shl
+	local.get $value
+	i32.store16
+	local.get $address
+	i32.const 16384
+	i32.ge_u
+	local.get $address
+	i32.const 24576
+	i32.lt_u
+	i32.and
+	if
+	local.get $address
+	local.get $value
+	call $hack/screen
+	end)
+
+(func $hack/push (param $value i32)
+	i32.const 0
+	call $hack/peek
+	local.get $value
+	call $hack/poke
+	i32.const 0
+	i32.const 0
+	call $hack/peek
+	i32.const 1
+	i32.add
+	call $hack/poke)
+
+(func $hack/pop (result i32)
+	i32.const 0
+	i32.const 0
+	call $hack/peek
+	i32.const 1
+	i32.sub
+	call $hack/poke
+	i32.const 0
+	call $hack/peek
+	call $hack/peek)
+
+;; pushes the frame of a call with nArgs arguments and refreshes the keyboard
+(func $hack/call (param $nArgs i32)
+	i32.const 0
+	call $hack/push
+	i32.const 1
+	call $hack/peek
+	call $hack/push
+	i32.const 2
+	call $hack/peek
+	call $hack/push
+	i32.const 3
+	call $hack/peek
+	call $hack/push
+	i32.const 4
+	call $hack/peek
+	call $hack/push
+	i32.const 2
+	i32.const 0
+	call $hack/peek
+	i32.const 5
+	i32.sub
+	local.get $nArgs
+	i32.sub
+	call $hack/poke
+	i32.const 1
+	i32.const 0
+	call $hack/peek
+	call $hack/poke
+	i32.const 24576
+	call $hack/keyboard
+	call $hack/poke)
+
+;; moves the return value to argument 0 and restores the caller's frame
+(func $hack/return
+	(local $frame i32)
+	i32.const 1
+	call $hack/peek
+	local.set $frame
+	i32.const 2
+	call $hack/peek
+	call $hack/pop
+	call $hack/poke
+	i32.const 0
+	i32.const 2
+	call $hack/peek
+	i32.const 1
+	i32.add
+	call $hack/poke
+	i32.const 4
+	local.get $frame
+	i32.const 1
+	i32.sub
+	call $hack/peek
+	call $hack/poke
+	i32.const 3
+	local.get $frame
+	i32.const 2
+	i32.sub
+	call $hack/peek
+	call $hack/poke
+	i32.const 2
+	local.get $frame
+	i32.const 3
+	i32.sub
+	call $hack/peek
+	call $hack/poke
+	i32.const 1
+	local.get $frame
+	i32.const 4
+	i32.sub
+	call $hack/peek
+	call $hack/poke)
+
+(func $Main.fibonacci
+	(local $pc i32) (local $t i32)
+	loop $dispatch
+	block $s2
+	block $s1
+	block $s0
+	local.get $pc
+	br_table $s0 $s1 $s2
+	end ;; $s0
+	;; push argument 0
+	i32.const 2
+	call $hack/peek
+	i32.const 0
+	i32.add
+	call $hack/peek
+	call $hack/push
+	;; push constant 2
+	i32.const 2
+	call $hack/push
+	;; lt
+	call $hack/pop
+	local.set $t
+	call $hack/pop
+	local.get $t
+	i32.lt_s
+	local.set $t
+	i32.const 0
+	local.get $t
+	i32.sub
+	call $hack/push
+	;; if-goto IF_TRUE
+	call $hack/pop
+	if
+	i32.const 1
+	local.set $pc
+	br $dispatch
+	end
+	;; goto IF_FALSE
+	i32.const 2
+	local.set $pc
+	br $dispatch
+	end ;; $s1
+	;; label IF_TRUE
+	;; push argument 0
+	i32.const 2
+	call $hack/peek
+	i32.const 0
+	i32.add
+	call $hack/peek
+	call $hack/push
+	;; return
+	call $hack/return
+	return
+	end ;; $s2
+	;; label IF_FALSE
+	;; push argument 0
+	i32.const 2
+	call $hack/peek
+	i32.const 0
+	i32.add
+	call $hack/peek
+	call $hack/push
+	;; push constant 2
+	i32.const 2
+	call $hack/push
+	;; sub
+	call $hack/pop
+	local.set $t
+	call $hack/pop
+	local.get $t
+	i32.sub
+	call $hack/push
+	;; call Main.fibonacci 1
+	i32.const 1
+	call $hack/call
+	call $Main.fibonacci
+	;; push argument 0
+	i32.const 2
+	call $hack/peek
+	i32.const 0
+	i32.add
+	call $hack/peek
+	call $hack/push
+	;; push constant 1
+	i32.const 1
+	call $hack/push
+	;; sub
+	call $hack/pop
+	local.set $t
+	call $hack/pop
+	local.get $t
+	i32.sub
+	call $hack/push
+	;; call Main.fibonacci 1
+	i32.const 1
+	call $hack/call
+	call $Main.fibonacci
+	;; add
+	call $hack/pop
+	local.set $t
+	call $hack/pop
+	local.get $t
+	i32.add
+	call $hack/push
+	;; return
+	call $hack/return
+	return
+	end
+	unreachable)
+
+(func $Sys.init
+	(local $pc i32) (local $t i32)
+	loop $dispatch
+	block $s1
+	block $s0
+	local.get $pc
+	br_table $s0 $s1
+	end ;; $s0
+	;; push constant 4
+	i32.const 4
+	call $hack/push
+	;; call Main.fibonacci 1
+	i32.const 1
+	call $hack/call
+	call $Main.fibonacci
+	end ;; $s1
+	;; label WHILE
+	;; goto WHILE
+	i32.const 1
+	local.set $pc
+	br $dispatch
+	end
+	unreachable)
+
+(func (export "main")
+	i32.const 0
+	i32.const 256
+	call $hack/poke
+	i32.const 0
+	call $hack/call
+	call $Sys.init)
+)
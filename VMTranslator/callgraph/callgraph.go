@@ -0,0 +1,443 @@
+package callgraph
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pcjun97/JackVMTranslator/parser"
+	"github.com/pcjun97/JackVMTranslator/verify"
+)
+
+// words pushed by every call besides the arguments: the return address and
+// the saved LCL, ARG, THIS and THAT
+const savedWords = 5
+
+// Call is a call command. Below is the depth of the working stack of the
+// caller beneath the arguments of the call.
+type Call struct {
+	Callee string
+	Args   int
+	Line   int
+	Below  int
+}
+
+// Function is a node of the call graph. Args is the largest number of
+// arguments it is called with and Working the deepest working stack of its
+// own body. Depth is the number of words from its first argument up to the
+// deepest point of any call path starting in it, where calls back into a
+// recursion cycle are left out. Recursive is set if such a call was left
+// out, Incomplete if a path calls a function that is not defined.
+type Function struct {
+	Name       string
+	File       string
+	Line       int
+	Vars       int
+	Args       int
+	Working    int
+	Calls      []Call
+	Depth      int
+	Recursive  bool
+	Incomplete bool
+	Defined    bool
+	Diagnostic bool
+}
+
+// Frame returns the size of the frame of a call: the arguments, the saved
+// words and the local variables.
+func (f *Function) Frame() int {
+	return f.Args + savedWords + f.Vars
+}
+
+type Graph struct {
+	Functions map[string]*Function
+	Order     []string
+	Cycles    [][]string
+
+	component map[string]int
+	below     map[string]int
+	done      map[string]bool
+}
+
+// Build builds the call graph of the functions of all files and computes the
+// stack depths. Functions that are called but not defined get a node with
+// Defined unset.
+func Build(files []parser.File) *Graph {
+	g := Graph{
+		Functions: make(map[string]*Function),
+		component: make(map[string]int),
+		below:     make(map[string]int),
+		done:      make(map[string]bool),
+	}
+
+	for _, file := range files {
+		for _, commands := range parser.Functions(file.Commands) {
+			if commands[0].Type != parser.C_FUNCTION {
+				continue
+			}
+			g.add(file.Name, commands)
+		}
+	}
+
+	for _, name := range g.Order {
+		for _, call := range g.Functions[name].Calls {
+			callee := g.node(call.Callee)
+			if call.Args > callee.Args {
+				callee.Args = call.Args
+			}
+		}
+	}
+
+	g.components()
+
+	for _, name := range g.Order {
+		g.depth(name)
+	}
+
+	for _, name := range g.Order {
+		f := g.Functions[name]
+		f.Depth = f.Args + savedWords + g.below[name]
+	}
+
+	return &g
+}
+
+func (g *Graph) add(file string, commands []parser.Command) {
+	f := g.node(commands[0].Arg1)
+	f.File = file
+	f.Line = commands[0].Line
+	f.Vars = commands[0].Arg2
+	f.Defined = true
+
+	depths, diagnostics := verify.Depths(file, commands)
+	f.Diagnostic = len(diagnostics) > 0
+
+	for i, command := range commands {
+		if depths[i] < 0 {
+			continue
+		}
+
+		pops, pushes := command.Effect()
+		after := depths[i] - pops + pushes
+		if depths[i] > f.Working {
+			f.Working = depths[i]
+		}
+		if after > f.Working {
+			f.Working = after
+		}
+
+		if command.Type == parser.C_CALL {
+			below := depths[i] - command.Arg2
+			if below < 0 {
+				below = 0
+			}
+			f.Calls = append(f.Calls, Call{command.Arg1, command.Arg2, command.Line, below})
+		}
+	}
+}
+
+func (g *Graph) node(name string) *Function {
+	f, ok := g.Functions[name]
+	if !ok {
+		f = &Function{Name: name}
+		g.Functions[name] = f
+		g.Order = append(g.Order, name)
+	}
+	return f
+}
+
+// components finds the strongly connected components with Tarjan's
+// algorithm and keeps those that form a cycle
+func (g *Graph) components() {
+	index := make(map[string]int)
+	low := make(map[string]int)
+	onStack := make(map[string]bool)
+	var stack []string
+	count := 0
+
+	var visit func(name string)
+	visit = func(name string) {
+		index[name] = count
+		low[name] = count
+		count++
+		stack = append(stack, name)
+		onStack[name] = true
+
+		for _, call := range g.Functions[name].Calls {
+			if _, ok := index[call.Callee]; !ok {
+				visit(call.Callee)
+				if low[call.Callee] < low[name] {
+					low[name] = low[call.Callee]
+				}
+			} else if onStack[call.Callee] && index[call.Callee] < low[name] {
+				low[name] = index[call.Callee]
+			}
+		}
+
+		if low[name] != index[name] {
+			return
+		}
+
+		var members []string
+		for {
+			member := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[member] = false
+			g.component[member] = index[name]
+			members = append(members, member)
+			if member == name {
+				break
+			}
+		}
+
+		if len(members) > 1 || g.callsItself(name) {
+			g.Cycles = append(g.Cycles, g.cycle(members))
+		}
+	}
+
+	for _, name := range g.Order {
+		if _, ok := index[name]; !ok {
+			visit(name)
+		}
+	}
+
+	sort.SliceStable(g.Cycles, func(i, j int) bool {
+		return g.position(g.Cycles[i][0]) < g.position(g.Cycles[j][0])
+	})
+}
+
+func (g *Graph) callsItself(name string) bool {
+	for _, call := range g.Functions[name].Calls {
+		if call.Callee == name {
+			return true
+		}
+	}
+	return false
+}
+
+// cycle returns a shortest path through the members of a component from its
+// first function in program order back to it
+func (g *Graph) cycle(members []string) []string {
+	inComponent := make(map[string]bool)
+	start := members[0]
+	for _, member := range members {
+		inComponent[member] = true
+		if g.position(member) < g.position(start) {
+			start = member
+		}
+	}
+
+	previous := make(map[string]string)
+	queue := []string{start}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+
+		for _, call := range g.Functions[name].Calls {
+			if call.Callee == start {
+				path := []string{start}
+				for n := name; n != start; n = previous[n] {
+					path = append(path, n)
+				}
+				for i, j := 1, len(path)-1; i < j; i, j = i+1, j-1 {
+					path[i], path[j] = path[j], path[i]
+				}
+				return append(path, start)
+			}
+			if _, seen := previous[call.Callee]; !seen && inComponent[call.Callee] {
+				previous[call.Callee] = name
+				queue = append(queue, call.Callee)
+			}
+		}
+	}
+
+	return []string{start, start}
+}
+
+func (g *Graph) position(name string) int {
+	for i, n := range g.Order {
+		if n == name {
+			return i
+		}
+	}
+	return len(g.Order)
+}
+
+// depth computes the words from the local segment of a function up to the
+// deepest point of its calls; calls within its own component are left out,
+// so the computation follows the acyclic graph of components
+func (g *Graph) depth(name string) int {
+	if g.done[name] {
+		return g.below[name]
+	}
+
+	f := g.Functions[name]
+	deepest := f.Working
+
+	for _, call := range f.Calls {
+		callee := g.Functions[call.Callee]
+		if g.component[call.Callee] == g.component[name] {
+			f.Recursive = true
+			continue
+		}
+
+		d := call.Below + call.Args + savedWords + g.depth(call.Callee)
+		if d > deepest {
+			deepest = d
+		}
+		f.Recursive = f.Recursive || callee.Recursive
+		f.Incomplete = f.Incomplete || callee.Incomplete || !callee.Defined
+	}
+
+	g.below[name] = f.Vars + deepest
+	g.done[name] = true
+	return g.below[name]
+}
+
+// Roots returns the entry points of the program: Sys.init if it is defined,
+// since the bootstrap code calls nothing else, otherwise the functions that
+// are not called by any other function.
+func (g *Graph) Roots() []string {
+	if f, ok := g.Functions["Sys.init"]; ok && f.Defined {
+		return []string{"Sys.init"}
+	}
+
+	called := make(map[string]bool)
+	for _, name := range g.Order {
+		for _, call := range g.Functions[name].Calls {
+			if call.Callee != name {
+				called[call.Callee] = true
+			}
+		}
+	}
+
+	var roots []string
+	for _, name := range g.Order {
+		if !called[name] && g.Functions[name].Defined {
+			roots = append(roots, name)
+		}
+	}
+
+	return roots
+}
+
+// WriteReport lists the cycles, the functions that are called but not
+// defined, the frame size and depth of every function and the maximum stack
+// depth from every root. The stack depth of a root counts the words pushed
+// by the bootstrap call of Sys.init, so 256 plus the depth is the highest SP
+// of the program.
+func (g *Graph) WriteReport(w io.Writer) error {
+	var b strings.Builder
+
+	if len(g.Cycles) > 0 {
+		b.WriteString("recursion cycles:\n")
+		for _, cycle := range g.Cycles {
+			fmt.Fprintf(&b, "  %s\n", strings.Join(cycle, " -> "))
+		}
+	}
+
+	var undefined []string
+	for _, name := range g.Order {
+		if !g.Functions[name].Defined {
+			undefined = append(undefined, name)
+		}
+	}
+	if len(undefined) > 0 {
+		b.WriteString("undefined functions, counted with an empty frame:\n")
+		for _, name := range undefined {
+			fmt.Fprintf(&b, "  %s\n", name)
+		}
+	}
+
+	b.WriteString("functions:\n")
+	for _, name := range g.Order {
+		f := g.Functions[name]
+		if !f.Defined {
+			continue
+		}
+		fmt.Fprintf(&b, "  %s.vm:%d: %s: frame %d (%d args, %d saved, %d vars), working stack %d, depth %d%s\n",
+			f.File, f.Line, f.Name, f.Frame(), f.Args, savedWords, f.Vars, f.Working, f.Depth, g.notes(f))
+	}
+
+	for _, name := range g.Roots() {
+		f := g.Functions[name]
+		depth := savedWords + g.below[name]
+		fmt.Fprintf(&b, "maximum stack depth from %s: %d words, SP up to %d%s\n", name, depth, 256+depth, g.notes(f))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (g *Graph) notes(f *Function) string {
+	var notes []string
+	if f.Recursive {
+		notes = append(notes, "non-recursive paths only")
+	}
+	if f.Incomplete {
+		notes = append(notes, "calls undefined functions")
+	}
+	if f.Diagnostic {
+		notes = append(notes, "stack discipline violated, see -verify")
+	}
+
+	if len(notes) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(notes, ", ") + ")"
+}
+
+// WriteDOT writes the call graph in the Graphviz DOT language. Nodes are
+// labelled with the frame size and depth, edges with the number of call
+// sites; edges within a recursion cycle are red and undefined functions
+// dashed.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+
+	b.WriteString("digraph calls {\n")
+	b.WriteString("  node [shape=box];\n")
+
+	for _, name := range g.Order {
+		f := g.Functions[name]
+		if !f.Defined {
+			fmt.Fprintf(&b, "  %q [style=dashed];\n", name)
+			continue
+		}
+		fmt.Fprintf(&b, "  %q [label=%q];\n", name, fmt.Sprintf("%s\nframe %d, depth %d", name, f.Frame(), f.Depth))
+	}
+
+	for _, name := range g.Order {
+		f := g.Functions[name]
+		sites := make(map[string]int)
+		var callees []string
+		for _, call := range f.Calls {
+			if sites[call.Callee] == 0 {
+				callees = append(callees, call.Callee)
+			}
+			sites[call.Callee]++
+		}
+
+		for _, callee := range callees {
+			attributes := ""
+			if sites[callee] > 1 {
+				attributes = fmt.Sprintf("label=\"%d\"", sites[callee])
+			}
+			if g.component[callee] == g.component[name] {
+				if attributes != "" {
+					attributes += ", "
+				}
+				attributes += "color=red"
+			}
+			if attributes != "" {
+				attributes = " [" + attributes + "]"
+			}
+			fmt.Fprintf(&b, "  %q -> %q%s;\n", name, callee, attributes)
+		}
+	}
+
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/pcjun97/JackVMTranslator/backend"
+	"github.com/pcjun97/JackVMTranslator/backend/hack"
+	"github.com/pcjun97/JackVMTranslator/cpu"
+	"github.com/pcjun97/JackVMTranslator/parser"
+	"github.com/pcjun97/JackVMTranslator/vm"
+)
+
+// most instructions the Hack code of a single VM command may take
+const commandLimit = 1 << 20
+
+// checker runs a program on the VM emulator and its translation on the Hack
+// CPU, one VM command at a time. A command whose Hack code calls into Math
+// and a tail call with the return after it are run as a whole, since the
+// machines only agree again once they are done.
+type checker struct {
+	m         *vm.Machine
+	c         *cpu.CPU
+	starts    []int
+	atCommand map[int]bool
+	whole     map[int]bool
+	tailCalls map[int]bool
+	ram       [vm.RAMSize]int16
+	top       int
+}
+
+func main() {
+	extended := flag.Bool("ext", false, "accept the extended instruction set")
+	steps := flag.Int("steps", 1000000, "compare at most `n` VM commands")
+	mathFallback := flag.Bool("ext-math", false, "lower mul, div and shr to calls into Math")
+	checked := flag.Bool("checked", false, "halt with an error code when the stack overflows")
+	stackLimit := flag.Int("stack-limit", 2048, "highest allowed SP in checked mode")
+	tailCalls := flag.Bool("tail-calls", false, "reuse the current frame for a call followed by return")
+
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: vmcheck [options] source")
+		fmt.Fprintln(flag.CommandLine.Output(), "runs the program on the VM emulator and its Hack translation on the CPU emulator side by side, and reports the first VM command after which the stack, segments or RAM differ")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	files, err := parser.ReadFiles(flag.Arg(0), *extended || *mathFallback)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	k, err := newChecker(files, hack.Options{
+		MathFallback: *mathFallback,
+		Checked:      *checked,
+		StackLimit:   *stackLimit,
+		TailCalls:    *tailCalls,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	count, err := k.run(*steps)
+	if err != nil {
+		log.Fatalf("divergence after %d commands: %v", count, err)
+	}
+
+	if k.m.Halted {
+		fmt.Printf("no divergence, program halted after %d commands\n", count)
+	} else {
+		fmt.Printf("no divergence in %d commands\n", count)
+	}
+}
+
+func newChecker(files []parser.File, options hack.Options) (*checker, error) {
+	m, err := vm.Load(files, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(m.Frames) == 0 {
+		return nil, errors.New("the program has no Sys.init to bootstrap")
+	}
+
+	var asm bytes.Buffer
+	w := hack.NewCodeWriter(&asm, options)
+	var starts []int
+	whole := make(map[int]bool)
+	tailCalls := make(map[int]bool)
+
+	for _, file := range files {
+		w.SetFileName(file.Name)
+		inFunction := false
+
+		for i := 0; i < len(file.Commands); i++ {
+			command := file.Commands[i]
+			inFunction = inFunction || command.Type == parser.C_FUNCTION
+
+			if options.MathFallback && command.Type == parser.C_ARITHMETIC && mathCommands[command.Arg1] {
+				whole[len(starts)] = true
+			}
+
+			// the translator writes a call followed by return as one tail
+			// call, whose code belongs to the call
+			if options.TailCalls && inFunction && command.Type == parser.C_CALL && i+1 < len(file.Commands) && file.Commands[i+1].Type == parser.C_RETURN {
+				tailCalls[len(starts)] = true
+				starts = append(starts, w.Address())
+				if err := w.TailCall(command.Arg1, command.Arg2); err != nil {
+					return nil, fmt.Errorf("%s.vm:%d: %w", file.Name, command.Line, err)
+				}
+				starts = append(starts, w.Address())
+				i++
+				continue
+			}
+
+			starts = append(starts, w.Address())
+			if err := backend.Write(w, command); err != nil {
+				return nil, fmt.Errorf("%s.vm:%d: %w", file.Name, command.Line, err)
+			}
+		}
+	}
+	starts = append(starts, w.Address())
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	c, err := cpu.Load(&asm)
+	if err != nil {
+		return nil, err
+	}
+
+	atCommand := make(map[int]bool)
+	for _, start := range starts[:len(starts)-1] {
+		atCommand[start] = true
+	}
+
+	return &checker{m: m, c: c, starts: starts, atCommand: atCommand, whole: whole, tailCalls: tailCalls}, nil
+}
+
+// the commands that -ext-math lowers to calls into Math
+var mathCommands map[string]bool = map[string]bool{"mul": true, "div": true, "shr": true}
+
+// run runs the bootstrap code, then compares both machines after every VM
+// command, and returns the number of commands executed
+func (k *checker) run(steps int) (int, error) {
+	if err := k.advance(); err != nil {
+		return 0, fmt.Errorf("bootstrap: %w", err)
+	}
+	if err := k.compare(); err != nil {
+		return 0, fmt.Errorf("bootstrap: %w", err)
+	}
+
+	for count := 0; count < steps; count++ {
+		if k.m.Halted {
+			return count, nil
+		}
+
+		pc := k.m.PC
+		i := k.m.Program[pc]
+
+		if k.tailCalls[pc] {
+			n, err := k.tailCall(steps - count)
+			if err == nil && !k.m.Halted {
+				err = k.compare()
+			}
+			if err != nil {
+				return count + n, fmt.Errorf("%s: %w", i, err)
+			}
+			if k.m.Halted {
+				return count + n, nil
+			}
+			// the loop counts the call itself
+			count += n - 1
+			continue
+		}
+
+		if err := k.m.Step(); err != nil {
+			return count, fmt.Errorf("VM error: %w", err)
+		}
+
+		if k.m.Halted {
+			return count + 1, nil
+		}
+
+		if k.whole[pc] {
+			if err := k.advanceTo(k.starts[pc+1], int(k.m.RAM[vm.SP]), commandLimit); err != nil {
+				return count, fmt.Errorf("%s: %w", i, err)
+			}
+		} else if k.starts[pc+1] > k.starts[pc] {
+			if err := k.advance(); err != nil {
+				return count, fmt.Errorf("%s: %w", i, err)
+			}
+		}
+
+		if err := k.compare(); err != nil {
+			return count + 1, fmt.Errorf("%s: %w", i, err)
+		}
+	}
+
+	return steps, nil
+}
+
+// advance runs the CPU until it reaches the first instruction of a VM
+// command
+func (k *checker) advance() error {
+	for n := 0; n < commandLimit; n++ {
+		if err := k.c.Step(); err != nil {
+			return fmt.Errorf("Hack error at ROM[%d]: %w", k.c.PC, err)
+		}
+		if k.atCommand[k.c.PC] {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Hack code did not reach the next command within %d instructions", commandLimit)
+}
+
+// advanceTo runs the CPU until it reaches the instruction at address with SP
+// at sp, over the code of any commands in between
+func (k *checker) advanceTo(address, sp, limit int) error {
+	for n := 0; n < limit; n++ {
+		if err := k.c.Step(); err != nil {
+			return fmt.Errorf("Hack error at ROM[%d]: %w", k.c.PC, err)
+		}
+		if k.c.PC == address && int(k.c.RAM[vm.SP]) == sp {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Hack code did not reach ROM[%d] within %d instructions", address, limit)
+}
+
+// tailCall runs the VM through a tail call and the return after it, which
+// leaves the current function, and the CPU up to the same point; the stack
+// of the Hack code differs from the VM's until then, since the callee reuses
+// the frame. It returns the number of commands the VM executed.
+func (k *checker) tailCall(steps int) (int, error) {
+	depth := len(k.m.Frames)
+	count := 0
+
+	for !k.m.Halted && len(k.m.Frames) >= depth {
+		if count == steps {
+			return count, fmt.Errorf("tail call did not return within %d commands", steps)
+		}
+		if err := k.m.Step(); err != nil {
+			return count, fmt.Errorf("VM error: %w", err)
+		}
+		count++
+	}
+
+	if k.m.Halted {
+		return count, nil
+	}
+
+	return count, k.advanceTo(k.starts[k.m.PC], int(k.m.RAM[vm.SP]), commandLimit*count)
+}
+
+func (k *checker) compare() error {
+	if k.c.PC != k.starts[k.m.PC] {
+		return fmt.Errorf("VM continues at %s, Hack at ROM[%d] instead of ROM[%d]", k.m.Program[k.m.PC], k.c.PC, k.starts[k.m.PC])
+	}
+
+	returns := k.returnAddresses()
+	for address, vmValue := range returns {
+		if vmValue >= 0 && int(k.c.RAM[address]) != k.starts[vmValue] {
+			return fmt.Errorf("return address at RAM[%d] is %s at VM level, ROM[%d] instead of ROM[%d] at Hack level", address, k.m.Program[vmValue], k.c.RAM[address], k.starts[vmValue])
+		}
+	}
+
+	// the scratch registers of the generated code, the dead part of the
+	// stack up to the highest SP so far and the return addresses are not
+	// compared, so they are copied over from the VM before comparing the
+	// whole RAM at once
+	sp := int(k.m.RAM[vm.SP])
+	if sp > k.top {
+		k.top = sp
+	}
+	end := 2048
+	if k.top >= end {
+		end = k.top + 1
+	}
+
+	k.ram = k.c.RAM
+	copy(k.ram[13:16], k.m.RAM[13:16])
+	if sp >= 256 && end <= vm.RAMSize {
+		copy(k.ram[sp:end], k.m.RAM[sp:end])
+	}
+	for address := range returns {
+		k.ram[address] = k.m.RAM[address]
+	}
+
+	if k.ram == k.m.RAM {
+		return nil
+	}
+
+	for address := range k.ram {
+		if k.m.RAM[address] != k.ram[address] {
+			return fmt.Errorf("%s is %d at VM level, %d at Hack level", describe(address), k.m.RAM[address], k.ram[address])
+		}
+	}
+
+	return nil
+}
+
+// returns the address of the return address of every frame with its value,
+// the index of the instruction to return to, at VM level
+func (k *checker) returnAddresses() map[int]int {
+	returns := make(map[int]int)
+
+	lcl := int(k.m.RAM[vm.LCL])
+	for range k.m.Frames {
+		if lcl < 5 || lcl >= vm.RAMSize {
+			break
+		}
+		returns[lcl-5] = int(k.m.RAM[lcl-5])
+		lcl = int(k.m.RAM[lcl-4])
+	}
+
+	return returns
+}
+
+func describe(address int) string {
+	switch {
+	case address <= vm.THAT:
+		return []string{"SP", "LCL", "ARG", "THIS", "THAT"}[address]
+	case address < 13:
+		return fmt.Sprintf("temp %d (RAM[%d])", address-5, address)
+	case address < 256:
+		return fmt.Sprintf("static RAM[%d]", address)
+	case address < 2048:
+		return fmt.Sprintf("stack RAM[%d]", address)
+	case address < 16384:
+		return fmt.Sprintf("heap RAM[%d]", address)
+	case address < 24576:
+		return fmt.Sprintf("screen RAM[%d]", address)
+	}
+	return fmt.Sprintf("RAM[%d]", address)
+}
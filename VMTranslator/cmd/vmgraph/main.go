@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/pcjun97/JackVMTranslator/callgraph"
+	"github.com/pcjun97/JackVMTranslator/parser"
+)
+
+func main() {
+	extended := flag.Bool("ext", false, "accept the extended instruction set")
+	dot := flag.Bool("dot", false, "write the call graph in the Graphviz DOT language instead of the report")
+
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: vmgraph [options] source")
+		fmt.Fprintln(flag.CommandLine.Output(), "reports the recursion cycles, the frame size of every function and the maximum stack depth of the program")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	files, err := parser.ReadFiles(flag.Arg(0), *extended)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	g := callgraph.Build(files)
+
+	if *dot {
+		err = g.WriteDOT(os.Stdout)
+	} else {
+		err = g.WriteReport(os.Stdout)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pcjun97/JackVMTranslator/parser"
+	"github.com/pcjun97/JackVMTranslator/vm"
+	"github.com/pcjun97/JackVMTranslator/vm/jackos"
+)
+
+const help = `commands:
+  run, continue, c       run until a breakpoint is reached or the program halts
+  step, s                execute one command, entering calls
+  next, n                execute one command, stepping over calls
+  finish                 run until the current function returns
+  break, b NAME          stop at function NAME or at label NAME (LABEL or Function$LABEL)
+  delete, d NAME         remove a breakpoint
+  info                   list breakpoints
+  print, p SEGMENT [n]   print local, argument, this, that, pointer, temp or stack;
+                         this and that print n words, 8 by default
+  print, p static [FILE] print the statics of FILE, the current file by default
+  where, bt              print the call frames
+  list, l                print the commands around the current one
+  help                   print this help
+  quit, q                exit
+an empty line repeats the previous command`
+
+type debugger struct {
+	m           *vm.Machine
+	out         io.Writer
+	breakpoints map[string][]int
+	interrupt   chan os.Signal
+}
+
+func main() {
+	extended := flag.Bool("ext", false, "accept the extended instruction set")
+	run := flag.Bool("run", false, "run the program to completion without the debugger")
+	steps := flag.Int("steps", 0, "stop with an error after `n` commands with -run, 0 for no limit")
+	classes := flag.String("os", "all", "comma separated built-in OS classes, all or none")
+	input := flag.String("input", "", "read keyboard input from `file`, standard input with -run by default")
+
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: vmrun [options] source")
+		fmt.Fprintln(flag.CommandLine.Output(), "built-in OS classes are replaced by the source's own version of the class")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	files, err := parser.ReadFiles(flag.Arg(0), *extended)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var in io.Reader = strings.NewReader("")
+	if *input != "" {
+		f, err := os.Open(*input)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		in = f
+	} else if *run {
+		in = os.Stdin
+	}
+
+	// the output of the program is buffered when it runs to completion, and
+	// written right away in the debugger so that it shows between prompts
+	var out io.Writer = os.Stdout
+	buffered := bufio.NewWriter(os.Stdout)
+	if *run {
+		out = buffered
+	}
+
+	files, natives, err := jackos.New(in, out).Install(files, osClasses(*classes))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	m, err := vm.Load(files, natives)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *run {
+		err := execute(m, *steps)
+		if flushErr := buffered.Flush(); err == nil {
+			err = flushErr
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	d := debugger{
+		m:           m,
+		out:         os.Stdout,
+		breakpoints: make(map[string][]int),
+		interrupt:   make(chan os.Signal, 1),
+	}
+	signal.Notify(d.interrupt, os.Interrupt)
+
+	d.repl(os.Stdin)
+}
+
+func osClasses(classes string) []string {
+	switch classes {
+	case "all":
+		return jackos.Classes
+	case "none", "":
+		return nil
+	}
+	return strings.Split(classes, ",")
+}
+
+// runs the program until it halts, without a debugger
+func execute(m *vm.Machine, steps int) error {
+	for count := 0; !m.Halted; count++ {
+		if steps > 0 && count == steps {
+			return fmt.Errorf("step limit reached after %d commands", steps)
+		}
+		if err := m.Step(); err != nil && !errors.Is(err, vm.ErrHalted) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *debugger) repl(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	previous := ""
+
+	d.show()
+
+	for {
+		fmt.Fprint(d.out, "(vmrun) ")
+		if !scanner.Scan() {
+			fmt.Fprintln(d.out)
+			return
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			line = previous
+		}
+		previous = line
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if fields[0] == "quit" || fields[0] == "q" {
+			return
+		}
+
+		if err := d.execute(fields); err != nil {
+			fmt.Fprintln(d.out, err)
+		}
+	}
+}
+
+func (d *debugger) execute(fields []string) error {
+	switch fields[0] {
+	case "run", "continue", "c":
+		return d.run(func() bool { return false })
+	case "step", "s":
+		if err := d.m.Step(); err != nil {
+			return err
+		}
+		d.show()
+	case "next", "n":
+		depth := len(d.m.Frames)
+		if err := d.m.Step(); err != nil {
+			return err
+		}
+		if len(d.m.Frames) <= depth {
+			d.show()
+			return nil
+		}
+		return d.run(func() bool { return len(d.m.Frames) <= depth })
+	case "finish":
+		depth := len(d.m.Frames)
+		if depth == 0 {
+			return errors.New("not in a function")
+		}
+		return d.run(func() bool { return len(d.m.Frames) < depth })
+	case "break", "b":
+		if len(fields) != 2 {
+			return errors.New("usage: break NAME")
+		}
+		return d.setBreakpoint(fields[1])
+	case "delete", "d":
+		if len(fields) != 2 {
+			return errors.New("usage: delete NAME")
+		}
+		if _, ok := d.breakpoints[fields[1]]; !ok {
+			return fmt.Errorf("no breakpoint at %s", fields[1])
+		}
+		delete(d.breakpoints, fields[1])
+	case "info":
+		names := make([]string, 0, len(d.breakpoints))
+		for name := range d.breakpoints {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintln(d.out, name)
+		}
+	case "print", "p":
+		return d.print(fields[1:])
+	case "where", "bt":
+		d.where()
+	case "list", "l":
+		d.list()
+	case "help", "h":
+		fmt.Fprintln(d.out, help)
+	default:
+		return fmt.Errorf("unknown command: %s, try help", fields[0])
+	}
+
+	return nil
+}
+
+// run steps until done returns true, a breakpoint is reached, the program
+// halts or is interrupted
+func (d *debugger) run(done func() bool) error {
+	// an interrupt at the prompt is ignored, and must not stop this run
+	select {
+	case <-d.interrupt:
+	default:
+	}
+
+	for steps := 0; ; steps++ {
+		if d.m.Halted {
+			fmt.Fprintln(d.out, "program halted")
+			return nil
+		}
+
+		if err := d.m.Step(); err != nil {
+			if errors.Is(err, vm.ErrHalted) {
+				continue
+			}
+			return err
+		}
+
+		if done() || d.atBreakpoint() {
+			d.show()
+			return nil
+		}
+
+		if steps%4096 == 0 {
+			select {
+			case <-d.interrupt:
+				fmt.Fprintln(d.out, "interrupted")
+				d.show()
+				return nil
+			default:
+			}
+		}
+	}
+}
+
+func (d *debugger) atBreakpoint() bool {
+	for _, pcs := range d.breakpoints {
+		for _, pc := range pcs {
+			if d.m.PC == pc {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// a breakpoint stops before a function command or before every label
+// command with that name
+func (d *debugger) setBreakpoint(name string) error {
+	var pcs []int
+
+	for pc, i := range d.m.Program {
+		switch i.Command.Type {
+		case parser.C_FUNCTION:
+			if i.Command.Arg1 == name {
+				pcs = append(pcs, pc)
+			}
+		case parser.C_LABEL:
+			if i.Command.Arg1 == name || i.Function+"$"+i.Command.Arg1 == name {
+				pcs = append(pcs, pc)
+			}
+		}
+	}
+
+	if len(pcs) == 0 {
+		return fmt.Errorf("no function or label named %s", name)
+	}
+
+	d.breakpoints[name] = pcs
+	fmt.Fprintf(d.out, "breakpoint at %s\n", name)
+
+	return nil
+}
+
+func (d *debugger) print(args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return errors.New("usage: print SEGMENT [n]")
+	}
+
+	segment := args[0]
+	if segment == "static" {
+		return d.printStatic(args[1:])
+	}
+
+	count := 8
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid count: %s", args[1])
+		}
+		count = n
+	}
+
+	base := 0
+
+	switch segment {
+	case "local":
+		base, count = int(d.m.RAM[vm.LCL]), d.m.Locals()
+	case "argument":
+		base, count = int(d.m.RAM[vm.ARG]), d.m.Arguments()
+	case "this":
+		base = int(d.m.RAM[vm.THIS])
+	case "that":
+		base = int(d.m.RAM[vm.THAT])
+	case "pointer":
+		base, count = vm.THIS, 2
+	case "temp":
+		base, count = 5, 8
+	case "stack":
+		base = 256
+		if len(d.m.Frames) > 0 {
+			base = int(d.m.RAM[vm.LCL]) + d.m.Locals()
+		}
+		count = int(d.m.RAM[vm.SP]) - base
+	default:
+		return fmt.Errorf("unknown segment: %s", segment)
+	}
+
+	if count <= 0 {
+		fmt.Fprintf(d.out, "%s: empty\n", segment)
+		return nil
+	}
+
+	values := make([]string, 0, count)
+	for address := base; address < base+count; address++ {
+		value, err := d.m.Peek(address)
+		if err != nil {
+			return err
+		}
+		values = append(values, strconv.Itoa(int(value)))
+	}
+
+	fmt.Fprintf(d.out, "%s RAM[%d..%d]: %s\n", segment, base, base+count-1, strings.Join(values, " "))
+	return nil
+}
+
+// prints the statics of a file, the file of the current command by default,
+// as index=value since a file need not use every index
+func (d *debugger) printStatic(args []string) error {
+	file := ""
+	if len(args) == 1 {
+		file = args[0]
+	} else if len(d.m.Program) > 0 {
+		pc := d.m.PC
+		if pc >= len(d.m.Program) {
+			pc = len(d.m.Program) - 1
+		}
+		file = d.m.Program[pc].File
+	}
+
+	var values []string
+	for index := 0; index < 240; index++ {
+		if address, ok := d.m.Static(file, index); ok {
+			values = append(values, fmt.Sprintf("%d=%d", index, d.m.RAM[address]))
+		}
+	}
+
+	fmt.Fprintf(d.out, "static %s: %s\n", file, strings.Join(values, " "))
+	return nil
+}
+
+func (d *debugger) where() {
+	for j := len(d.m.Frames) - 1; j >= 0; j-- {
+		frame := d.m.Frames[j]
+		caller := "bootstrap"
+		if frame.Return > 0 {
+			caller = d.m.Program[frame.Return-1].String()
+		}
+		fmt.Fprintf(d.out, "#%d %s called from %s\n", len(d.m.Frames)-1-j, frame.Function, caller)
+	}
+}
+
+func (d *debugger) list() {
+	from := d.m.PC - 4
+	if from < 0 {
+		from = 0
+	}
+
+	for pc := from; pc < from+9 && pc < len(d.m.Program); pc++ {
+		marker := "  "
+		if pc == d.m.PC {
+			marker = "=>"
+		}
+		fmt.Fprintf(d.out, "%s %s\n", marker, d.m.Program[pc])
+	}
+}
+
+func (d *debugger) show() {
+	if i, ok := d.m.Current(); ok {
+		fmt.Fprintln(d.out, i)
+	} else {
+		fmt.Fprintln(d.out, "program halted")
+	}
+}
@@ -0,0 +1,294 @@
+package cpu
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const RAMSize = 32768
+
+// the comp field with its a-bit, as in the Hack machine language, along with
+// the commutative forms the official assembler accepts as well
+var compMap map[string]int = map[string]int{
+	"0":   0b0101010,
+	"1":   0b0111111,
+	"-1":  0b0111010,
+	"D":   0b0001100,
+	"A":   0b0110000,
+	"M":   0b1110000,
+	"!D":  0b0001101,
+	"!A":  0b0110001,
+	"!M":  0b1110001,
+	"-D":  0b0001111,
+	"-A":  0b0110011,
+	"-M":  0b1110011,
+	"D+1": 0b0011111,
+	"A+1": 0b0110111,
+	"M+1": 0b1110111,
+	"D-1": 0b0001110,
+	"A-1": 0b0110010,
+	"M-1": 0b1110010,
+	"D+A": 0b0000010,
+	"D+M": 0b1000010,
+	"D-A": 0b0010011,
+	"D-M": 0b1010011,
+	"A-D": 0b0000111,
+	"M-D": 0b1000111,
+	"D&A": 0b0000000,
+	"D&M": 0b1000000,
+	"D|A": 0b0010101,
+	"D|M": 0b1010101,
+	"A+D": 0b0000010,
+	"M+D": 0b1000010,
+	"A&D": 0b0000000,
+	"M&D": 0b1000000,
+	"A|D": 0b0010101,
+	"M|D": 0b1010101,
+}
+
+var jumpMap map[string]int = map[string]int{
+	"":    0b000,
+	"JGT": 0b001,
+	"JEQ": 0b010,
+	"JGE": 0b011,
+	"JLT": 0b100,
+	"JNE": 0b101,
+	"JLE": 0b110,
+	"JMP": 0b111,
+}
+
+var predefined map[string]int = map[string]int{
+	"SP":     0,
+	"LCL":    1,
+	"ARG":    2,
+	"THIS":   3,
+	"THAT":   4,
+	"SCREEN": 16384,
+	"KBD":    24576,
+}
+
+type instruction struct {
+	address bool
+	value   int16
+	comp    int
+	dest    int
+	jump    int
+}
+
+// CPU executes Hack assembly. The program is assembled the way the Hack
+// assembler does it, so variables get the same addresses.
+type CPU struct {
+	RAM [RAMSize]int16
+	A   int16
+	D   int16
+	PC  int
+
+	rom     []instruction
+	symbols map[string]int
+}
+
+type line struct {
+	text   string
+	number int
+}
+
+// Load assembles a Hack assembly program.
+func Load(r io.Reader) (*CPU, error) {
+	c := CPU{symbols: make(map[string]int)}
+	for name, address := range predefined {
+		c.symbols[name] = address
+	}
+	for i := 0; i < 16; i++ {
+		c.symbols["R"+strconv.Itoa(i)] = i
+	}
+
+	var lines []line
+	scanner := bufio.NewScanner(r)
+	number := 0
+
+	for scanner.Scan() {
+		number++
+
+		text := scanner.Text()
+		if comment := strings.Index(text, "//"); comment >= 0 {
+			text = text[:comment]
+		}
+		text = strings.Join(strings.Fields(text), "")
+		if text == "" {
+			continue
+		}
+
+		if strings.HasPrefix(text, "(") && strings.HasSuffix(text, ")") {
+			label := text[1 : len(text)-1]
+			if _, ok := c.symbols[label]; ok {
+				return nil, fmt.Errorf("line %d: symbol %s already defined", number, label)
+			}
+			c.symbols[label] = len(lines)
+			continue
+		}
+
+		lines = append(lines, line{text, number})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	variable := 16
+	for _, l := range lines {
+		i, err := c.parse(l.text, &variable)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", l.number, err)
+		}
+		c.rom = append(c.rom, i)
+	}
+
+	return &c, nil
+}
+
+func (c *CPU) parse(text string, variable *int) (instruction, error) {
+	if strings.HasPrefix(text, "@") {
+		symbol := text[1:]
+
+		value, err := strconv.Atoi(symbol)
+		if err != nil {
+			address, ok := c.symbols[symbol]
+			if !ok {
+				address = *variable
+				c.symbols[symbol] = address
+				*variable++
+			}
+			value = address
+		}
+
+		if value < 0 || value >= RAMSize {
+			return instruction{}, fmt.Errorf("value out of range: %s is %d", symbol, value)
+		}
+
+		return instruction{address: true, value: int16(value)}, nil
+	}
+
+	i := instruction{}
+
+	if eq := strings.Index(text, "="); eq >= 0 {
+		for _, r := range text[:eq] {
+			switch r {
+			case 'A':
+				i.dest |= 0b100
+			case 'D':
+				i.dest |= 0b010
+			case 'M':
+				i.dest |= 0b001
+			default:
+				return instruction{}, fmt.Errorf("invalid dest: %s", text[:eq])
+			}
+		}
+		text = text[eq+1:]
+	}
+
+	jump := ""
+	if semicolon := strings.Index(text, ";"); semicolon >= 0 {
+		text, jump = text[:semicolon], text[semicolon+1:]
+	}
+
+	comp, ok := compMap[text]
+	if !ok {
+		return instruction{}, fmt.Errorf("invalid comp: %s", text)
+	}
+	i.comp = comp
+
+	if i.jump, ok = jumpMap[jump]; !ok {
+		return instruction{}, fmt.Errorf("invalid jump: %s", jump)
+	}
+
+	return i, nil
+}
+
+// Symbol returns the value of a label or variable.
+func (c *CPU) Symbol(name string) (int, bool) {
+	address, ok := c.symbols[name]
+	return address, ok
+}
+
+// Size returns the number of instructions of the program.
+func (c *CPU) Size() int {
+	return len(c.rom)
+}
+
+// Step executes the instruction at PC.
+func (c *CPU) Step() error {
+	if c.PC < 0 || c.PC >= len(c.rom) {
+		return fmt.Errorf("PC out of range: %d", c.PC)
+	}
+
+	i := c.rom[c.PC]
+	c.PC++
+
+	if i.address {
+		c.A = i.value
+		return nil
+	}
+
+	x, y := c.D, c.A
+	if i.comp&0b1000000 != 0 || i.dest&0b001 != 0 {
+		if c.A < 0 {
+			return errors.New("RAM address out of range")
+		}
+		if i.comp&0b1000000 != 0 {
+			y = c.RAM[c.A]
+		}
+	}
+
+	out := alu(i.comp, x, y)
+
+	if i.dest&0b001 != 0 {
+		c.RAM[c.A] = out
+	}
+
+	jump := (i.jump&0b100 != 0 && out < 0) || (i.jump&0b010 != 0 && out == 0) || (i.jump&0b001 != 0 && out > 0)
+	if jump {
+		c.PC = int(uint16(c.A))
+	}
+
+	if i.dest&0b100 != 0 {
+		c.A = out
+	}
+	if i.dest&0b010 != 0 {
+		c.D = out
+	}
+
+	return nil
+}
+
+// the zx, nx, zy, ny, f and no bits of the comp field
+func alu(comp int, x, y int16) int16 {
+	if comp&0b100000 != 0 {
+		x = 0
+	}
+	if comp&0b010000 != 0 {
+		x = ^x
+	}
+	if comp&0b001000 != 0 {
+		y = 0
+	}
+	if comp&0b000100 != 0 {
+		y = ^y
+	}
+
+	var out int16
+	if comp&0b000010 != 0 {
+		out = x + y
+	} else {
+		out = x & y
+	}
+
+	if comp&0b000001 != 0 {
+		out = ^out
+	}
+
+	return out
+}
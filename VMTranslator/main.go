@@ -1,79 +1,206 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"io"
 	"log"
 	"os"
 	"path"
+	"runtime"
 	"strings"
+
+	"github.com/pcjun97/JackVMTranslator/backend"
+	"github.com/pcjun97/JackVMTranslator/backend/cgen"
+	"github.com/pcjun97/JackVMTranslator/backend/hack"
+	"github.com/pcjun97/JackVMTranslator/backend/wat"
+	"github.com/pcjun97/JackVMTranslator/optimize"
+	"github.com/pcjun97/JackVMTranslator/parser"
+	"github.com/pcjun97/JackVMTranslator/verify"
 )
 
+var targetExtensions map[string]string = map[string]string{
+	"hack": ".asm",
+	"c":    ".c",
+	"wat":  ".wat",
+}
+
 func main() {
-	if len(os.Args) != 2 {
-		log.Fatalln("usage: VMTranslator source")
+	target := flag.String("target", "hack", "output format: hack, c or wat")
+	extended := flag.Bool("ext", false, "accept the extended instruction set")
+	mathFallback := flag.Bool("ext-math", false, "lower mul, div and shr to calls into Math")
+	checked := flag.Bool("checked", false, "halt with an error code when the stack overflows")
+	stackLimit := flag.Int("stack-limit", 2048, "highest allowed SP in checked mode")
+	profile := flag.Bool("profile", false, "count function calls and returns in RAM")
+	profileBase := flag.Int("profile-base", 0, "first RAM address of the profile counters, 0 for the top of the stack right below the heap")
+	verifyStack := flag.Bool("verify", false, "check the stack discipline of every function before translating")
+	tailCalls := flag.Bool("tail-calls", false, "reuse the current frame for a call followed by return")
+	noBootstrap := flag.Bool("no-bootstrap", false, "leave out the code that sets SP and calls Sys.init")
+	sourceMap := flag.Bool("source-map", false, "list the ROM address, VM line and Jack line of every command in a .map file")
+	inline := flag.Int("inline", 0, "inline leaf functions of at most `n` commands")
+	jobs := flag.Int("j", runtime.GOMAXPROCS(0), "translate up to `n` files at once")
+	outputPath := flag.String("o", "", "write the output to `file`, - for standard output")
+
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: VMTranslator [options] source...")
+		fmt.Fprintln(flag.CommandLine.Output(), "a source is a .vm file, a directory of .vm files, - for standard input, or NAME=PATH to read a file or standard input as NAME.vm")
+		fmt.Fprintln(flag.CommandLine.Output(), "the output goes next to a single file or directory source by default, to standard output otherwise")
+		flag.PrintDefaults()
 	}
+	flag.Parse()
 
-	inputPath := os.Args[1]
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
 
-	pathInfo, err := os.Stat(inputPath)
+	extension, ok := targetExtensions[*target]
+	if !ok {
+		log.Fatalf("unknown target: %s\n", *target)
+	}
+
+	if *target != "hack" && (*mathFallback || *checked || *profile || *tailCalls || *noBootstrap || *sourceMap) {
+		log.Fatalln("-ext-math, -checked, -profile, -tail-calls, -no-bootstrap and -source-map require the hack target")
+	}
+
+	if *stackLimit <= 256 || *stackLimit > 16384 {
+		log.Fatalln("stack limit must be between 257 and 16384")
+	}
+
+	if *profileBase != 0 && (*profileBase < 16 || *profileBase > 16382) {
+		log.Fatalln("profile base must be between 16 and 16382, below the screen")
+	}
+
+	outputFile := *outputPath
+	if outputFile == "" {
+		outputFile = defaultOutput(flag.Args(), extension)
+	}
+
+	if outputFile == "-" && (*profile || *sourceMap) {
+		log.Fatalln("-profile and -source-map write files next to the output, set it with -o")
+	}
+
+	sources, err := parser.ReadSources(flag.Args(), os.Stdin, *extended || *mathFallback)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	var outputFile string
-	var inputFiles []string
+	if *verifyStack {
+		failed := false
 
-	if pathInfo.IsDir() {
-		files, err := os.ReadDir(inputPath)
+		for _, s := range sources {
+			for _, d := range verify.Verify(s.Name, s.Commands) {
+				log.Println(d)
+				failed = true
+			}
+		}
+
+		if failed {
+			os.Exit(1)
+		}
+	}
+
+	sources = optimize.Inline(sources, *inline)
+
+	if *profile && *profileBase == 0 {
+		*profileBase = hack.ProfileBase(sources)
+		if *profileBase <= 256 {
+			log.Fatalln("too many functions for the profile counters to fit above the stack base, set -profile-base")
+		}
+		// the counters take the top of the stack, which checked mode keeps
+		// the stack out of
+		if *stackLimit > *profileBase {
+			*stackLimit = *profileBase
+		}
+	}
+
+	output := os.Stdout
+	if outputFile != "-" {
+		output, err = os.Create(outputFile)
 		if err != nil {
 			log.Fatal(err)
 		}
+	}
 
-		for _, file := range files {
-			if strings.HasSuffix(file.Name(), ".vm") {
-				inputFiles = append(inputFiles, path.Join(inputPath, file.Name()))
-			}
+	var c *hack.CodeWriter
+	var b backend.Backend
+
+	switch *target {
+	case "hack":
+		c = hack.NewCodeWriter(output, hack.Options{
+			MathFallback: *mathFallback,
+			Checked:      *checked,
+			StackLimit:   *stackLimit,
+			Profile:      *profile,
+			ProfileBase:  *profileBase,
+			TailCalls:    *tailCalls,
+			NoBootstrap:  *noBootstrap,
+		})
+		b = c
+	case "c":
+		b = cgen.NewCodeWriter(output)
+	case "wat":
+		b = wat.NewCodeWriter(output)
+	}
+
+	if err := backend.TranslateFiles(b, sources, *jobs); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := b.Close(); err != nil {
+		log.Fatal(err)
+	}
+
+	if outputFile != "-" {
+		if err := output.Close(); err != nil {
+			log.Fatal(err)
 		}
+	}
 
-		outputFile = path.Join(inputPath, path.Base(inputPath)+".asm")
-	} else {
-		if !strings.HasSuffix(inputPath, ".vm") {
-			log.Fatalln("invalid file type")
+	if *profile {
+		profileFile := strings.TrimSuffix(outputFile, ".asm") + ".profile"
+		if err := writeReport(profileFile, c.WriteProfile); err != nil {
+			log.Fatal(err)
 		}
+	}
 
-		outputFile = strings.TrimSuffix(inputPath, ".vm") + ".asm"
-		inputFiles = append(inputFiles, inputPath)
-	}
-
-	c := NewCodeWriter(outputFile)
-
-	for _, file := range inputFiles {
-		p := NewParser(file)
-		c.SetFileName(file)
-
-		for p.HasMoreLines() {
-			p.Advance()
-			switch p.CommandType() {
-			case C_ARITHMETIC:
-				c.WriteArithmetic(p.Arg1())
-			case C_PUSH:
-				c.WritePushPop("push", p.Arg1(), p.Arg2())
-			case C_POP:
-				c.WritePushPop("pop", p.Arg1(), p.Arg2())
-			case C_LABEL:
-				c.WriteLabel(p.Arg1())
-			case C_GOTO:
-				c.WriteGoto(p.Arg1())
-			case C_IF:
-				c.WriteIf(p.Arg1())
-			case C_FUNCTION:
-				c.WriteFunction(p.Arg1(), p.Arg2())
-			case C_CALL:
-				c.WriteCall(p.Arg1(), p.Arg2())
-			case C_RETURN:
-				c.WriteReturn()
-			}
+	if *sourceMap {
+		mapFile := strings.TrimSuffix(outputFile, ".asm") + ".map"
+		if err := writeReport(mapFile, c.WriteSourceMap); err != nil {
+			log.Fatal(err)
 		}
 	}
+}
+
+// the output goes next to a single .vm file or directory, and to standard
+// output for standard input and several sources
+func defaultOutput(sources []string, extension string) string {
+	if len(sources) != 1 || sources[0] == "-" {
+		return "-"
+	}
+
+	inputPath := sources[0]
+	pathInfo, err := os.Stat(inputPath)
+	if err != nil {
+		return "-"
+	}
+
+	if pathInfo.IsDir() {
+		return path.Join(inputPath, path.Base(inputPath)+extension)
+	}
+	return strings.TrimSuffix(inputPath, ".vm") + extension
+}
+
+func writeReport(file string, write func(io.Writer) error) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
 
-	c.Close()
+	return f.Close()
 }
@@ -0,0 +1,229 @@
+package optimize
+
+import (
+	"fmt"
+
+	"github.com/pcjun97/JackVMTranslator/parser"
+	"github.com/pcjun97/JackVMTranslator/verify"
+)
+
+const tempSize = 8
+
+// leaf is a function whose body can replace its call sites
+type leaf struct {
+	file          string
+	nVars         int
+	body          []parser.Command
+	nArgs         int
+	temps         map[int]bool
+	writesPointer [2]bool
+}
+
+// Inline replaces calls to small leaf functions, functions of at most
+// threshold commands that call no other function, with their bodies.
+// Arguments and locals of the inlined body are remapped to temp slots that
+// neither the caller nor the callee use, THIS and THAT are saved in temp
+// slots as well if the callee changes them, and a call is left alone if
+// there are not enough free slots. Only functions that pass verification
+// with exactly one value on the working stack at every return and use no
+// local beyond the ones they declare are inlined.
+func Inline(files []parser.File, threshold int) []parser.File {
+	if threshold <= 0 {
+		return files
+	}
+
+	leaves := make(map[string]*leaf)
+	for _, file := range files {
+		for _, function := range parser.Functions(file.Commands) {
+			if l := newLeaf(file.Name, function, threshold); l != nil {
+				leaves[function[0].Arg1] = l
+			}
+		}
+	}
+
+	result := make([]parser.File, len(files))
+	for i, file := range files {
+		var commands []parser.Command
+
+		for _, function := range parser.Functions(file.Commands) {
+			commands = append(commands, inlineCalls(file.Name, function, leaves)...)
+		}
+
+		result[i] = parser.File{Name: file.Name, Commands: commands}
+	}
+
+	return result
+}
+
+func newLeaf(file string, function []parser.Command, threshold int) *leaf {
+	if function[0].Type != parser.C_FUNCTION || len(function)-1 > threshold {
+		return nil
+	}
+
+	l := leaf{
+		file:  file,
+		nVars: function[0].Arg2,
+		body:  function[1:],
+		temps: make(map[int]bool),
+	}
+
+	depths, diagnostics := verify.Depths(file, function)
+	if len(diagnostics) > 0 {
+		return nil
+	}
+
+	for i, command := range l.body {
+		switch {
+		case command.Type == parser.C_CALL:
+			return nil
+		case command.Type == parser.C_RETURN && depths[i+1] != 1:
+			return nil
+		case command.Arg1 == "argument-indirect" || command.Arg1 == "local-indirect":
+			return nil
+		case command.Type != parser.C_PUSH && command.Type != parser.C_POP:
+		case command.Arg1 == "argument" && command.Arg2 >= l.nArgs:
+			l.nArgs = command.Arg2 + 1
+		case command.Arg1 == "local" && command.Arg2 >= l.nVars:
+			// the local lies outside the frame, which has no temp slot
+			return nil
+		case command.Arg1 == "temp":
+			l.temps[command.Arg2] = true
+		case command.Arg1 == "pointer" && command.Type == parser.C_POP:
+			l.writesPointer[command.Arg2] = true
+		}
+	}
+
+	return &l
+}
+
+func inlineCalls(file string, function []parser.Command, leaves map[string]*leaf) []parser.Command {
+	used := make(map[int]bool)
+	for _, command := range function {
+		if (command.Type == parser.C_PUSH || command.Type == parser.C_POP) && command.Arg1 == "temp" {
+			used[command.Arg2] = true
+		}
+	}
+
+	var result []parser.Command
+	count := 0
+
+	for _, command := range function {
+		l, ok := leaves[command.Arg1]
+		if command.Type != parser.C_CALL || !ok || command.Arg2 < l.nArgs {
+			result = append(result, command)
+			continue
+		}
+
+		var free []int
+		for i := 0; i < tempSize; i++ {
+			if !used[i] && !l.temps[i] {
+				free = append(free, i)
+			}
+		}
+
+		saves := 0
+		for _, writes := range l.writesPointer {
+			if writes {
+				saves++
+			}
+		}
+
+		if len(free) < command.Arg2+l.nVars+saves {
+			result = append(result, command)
+			continue
+		}
+
+		namespace := ""
+		if l.file != file {
+			namespace = l.file
+		}
+
+		result = append(result, l.expand(command, free, namespace, count)...)
+		count++
+	}
+
+	return result
+}
+
+// expand returns the body of the leaf for a call site, using the free temp
+// slots in order for the arguments, the saved pointers and the locals
+func (l *leaf) expand(call parser.Command, free []int, namespace string, count int) []parser.Command {
+	var commands []parser.Command
+	emit := func(commandType parser.CommandType, arg1 string, arg2 int) {
+		commands = append(commands, parser.Command{
+			Type:   commandType,
+			Arg1:   arg1,
+			Arg2:   arg2,
+			Line:   call.Line,
+			Source: call.Source,
+		})
+	}
+
+	nArgs := call.Arg2
+	args := free[:nArgs]
+	locals := free[nArgs : nArgs+l.nVars]
+	saved := free[nArgs+l.nVars:]
+
+	for i := nArgs - 1; i >= 0; i-- {
+		emit(parser.C_POP, "temp", args[i])
+	}
+
+	var saves [2]int
+	for i, writes := range l.writesPointer {
+		if writes {
+			saves[i] = saved[0]
+			saved = saved[1:]
+			emit(parser.C_PUSH, "pointer", i)
+			emit(parser.C_POP, "temp", saves[i])
+		}
+	}
+
+	for _, slot := range locals {
+		emit(parser.C_PUSH, "constant", 0)
+		emit(parser.C_POP, "temp", slot)
+	}
+
+	prefix := fmt.Sprintf("INLINE%d.", count)
+	end := prefix + "END"
+	last := len(l.body) - 1
+	needsEnd := false
+
+	for i, command := range l.body {
+		command.Line = call.Line
+
+		switch command.Type {
+		case parser.C_LABEL, parser.C_GOTO, parser.C_IF:
+			command.Arg1 = prefix + command.Arg1
+		case parser.C_RETURN:
+			if i == last {
+				continue
+			}
+			command = parser.Command{Type: parser.C_GOTO, Arg1: end, Arg2: -1, Line: call.Line, Source: command.Source}
+			needsEnd = true
+		case parser.C_PUSH, parser.C_POP:
+			switch command.Arg1 {
+			case "argument":
+				command.Arg1, command.Arg2 = "temp", args[command.Arg2]
+			case "local":
+				command.Arg1, command.Arg2 = "temp", locals[command.Arg2]
+			case "static":
+				command.Namespace = namespace
+			}
+		}
+
+		commands = append(commands, command)
+	}
+
+	if needsEnd {
+		emit(parser.C_LABEL, end, -1)
+	}
+
+	for i := len(saves) - 1; i >= 0; i-- {
+		if l.writesPointer[i] {
+			emit(parser.C_PUSH, "temp", saves[i])
+			emit(parser.C_POP, "pointer", i)
+		}
+	}
+
+	return commands
+}
@@ -0,0 +1,285 @@
+package optimize_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pcjun97/JackVMTranslator/optimize"
+	"github.com/pcjun97/JackVMTranslator/parser"
+	"github.com/pcjun97/JackVMTranslator/vm"
+)
+
+// Sys.init of every test program, which stores the result of Main.main in
+// static 0 and halts
+const sysInit = `
+function Sys.init 0
+call Main.main 0
+pop static 0
+label END
+goto END
+`
+
+// programs whose leaf functions are inlined, with the leaves that must be
+// gone from the inlined program and the result of Main.main
+var inlineTests []struct {
+	name   string
+	files  map[string]string
+	leaves []string
+	result int16
+} = []struct {
+	name   string
+	files  map[string]string
+	leaves []string
+	result int16
+}{
+	{
+		name: "arguments and locals",
+		files: map[string]string{"Main": `
+function Main.main 0
+push constant 3
+push constant 10
+call Main.f 2
+push constant 5
+push constant 1
+call Main.f 2
+add
+return
+function Main.f 2
+push argument 1
+push argument 0
+sub
+pop local 1
+push local 1
+push local 1
+add
+pop local 0
+push local 0
+push argument 0
+sub
+return
+`},
+		leaves: []string{"Main.f"},
+		result: -2,
+	},
+	{
+		name: "labels and returns",
+		files: map[string]string{"Main": `
+function Main.main 0
+push constant 7
+neg
+call Main.abs 1
+push constant 5
+call Main.abs 1
+add
+return
+function Main.abs 0
+push argument 0
+push constant 0
+lt
+if-goto NEGATIVE
+push argument 0
+return
+label NEGATIVE
+push argument 0
+neg
+return
+`},
+		leaves: []string{"Main.abs"},
+		result: 12,
+	},
+	{
+		name: "pointers",
+		files: map[string]string{"Main": `
+function Main.main 0
+push constant 3000
+pop pointer 0
+push constant 4000
+call Main.get 1
+push this 0
+add
+return
+function Main.get 0
+push argument 0
+pop pointer 0
+push constant 9
+pop this 0
+push this 0
+return
+`},
+		leaves: []string{"Main.get"},
+		result: 9,
+	},
+	{
+		name: "statics of another file",
+		files: map[string]string{
+			"Main": `
+function Main.main 0
+push constant 4
+call Counter.add 1
+pop temp 0
+push constant 6
+call Counter.add 1
+return
+`,
+			"Counter": `
+function Counter.add 0
+push static 0
+push argument 0
+add
+pop static 0
+push static 0
+return
+`},
+		leaves: []string{"Counter.add"},
+		result: 10,
+	},
+	{
+		name: "recursive caller",
+		files: map[string]string{"Main": `
+function Main.main 0
+push constant 10
+call Main.fib 1
+return
+function Main.fib 0
+push argument 0
+push constant 2
+lt
+if-goto BASE
+push argument 0
+call Main.dec 1
+call Main.fib 1
+push argument 0
+call Main.dec 1
+call Main.dec 1
+call Main.fib 1
+add
+return
+label BASE
+push argument 0
+return
+function Main.dec 0
+push argument 0
+push constant 1
+sub
+return
+`},
+		leaves: []string{"Main.dec"},
+		result: 55,
+	},
+}
+
+// runs every program as it is and with its leaves inlined, which must leave
+// the same live stack, frame pointers, statics and heap when it halts
+func TestInlineSameResult(t *testing.T) {
+	for _, test := range inlineTests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			files := parseFiles(t, test.files)
+			inlined := optimize.Inline(files, 20)
+
+			for _, leaf := range test.leaves {
+				if got := calls(inlined, leaf); got != 0 {
+					t.Errorf("%d calls of %s left, want it inlined", got, leaf)
+				}
+			}
+
+			want := run(t, files)
+			got := run(t, inlined)
+
+			address, _ := want.Static("Sys", 0)
+			if want.RAM[address] != test.result {
+				t.Fatalf("result = %d, want %d", want.RAM[address], test.result)
+			}
+
+			if got.RAM[vm.SP] != want.RAM[vm.SP] {
+				t.Fatalf("SP = %d, want %d", got.RAM[vm.SP], want.RAM[vm.SP])
+			}
+
+			// temp and R13 to R15 are scratch space of the inlined code, and
+			// the stack above SP is dead
+			compare := func(from, to int) {
+				for address := from; address < to; address++ {
+					if got.RAM[address] != want.RAM[address] {
+						t.Errorf("RAM[%d] = %d, want %d", address, got.RAM[address], want.RAM[address])
+					}
+				}
+			}
+			compare(vm.LCL, vm.THAT+1)
+			compare(16, int(want.RAM[vm.SP]))
+			compare(2048, vm.RAMSize)
+		})
+	}
+}
+
+// a leaf that uses a local it does not declare is left alone instead of
+// being expanded with a temp slot it does not have
+func TestInlineLocalOutOfRange(t *testing.T) {
+	files := parseFiles(t, map[string]string{"Main": `
+function Main.main 0
+call Main.get 0
+return
+function Main.get 1
+push local 3
+return
+`})
+
+	if got := calls(optimize.Inline(files, 5), "Main.get"); got != 1 {
+		t.Errorf("%d calls of Main.get left, want 1", got)
+	}
+}
+
+// parses the files of a program, in name order after Sys
+func parseFiles(t *testing.T, sources map[string]string) []parser.File {
+	t.Helper()
+
+	files := []parser.File{{Name: "Sys", Commands: parse(t, sysInit)}}
+	for _, name := range []string{"Counter", "Main"} {
+		if source, ok := sources[name]; ok {
+			files = append(files, parser.File{Name: name, Commands: parse(t, source)})
+		}
+	}
+
+	return files
+}
+
+func parse(t *testing.T, source string) []parser.Command {
+	t.Helper()
+	commands, err := parser.Parse(strings.NewReader(source), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return commands
+}
+
+// runs a program on the VM emulator until it halts
+func run(t *testing.T, files []parser.File) *vm.Machine {
+	t.Helper()
+
+	m, err := vm.Load(files, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 100000 && !m.Halted; i++ {
+		if err := m.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !m.Halted {
+		t.Fatal("program did not halt")
+	}
+
+	return m
+}
+
+func calls(files []parser.File, name string) int {
+	count := 0
+	for _, file := range files {
+		for _, command := range file.Commands {
+			if command.Type == parser.C_CALL && command.Arg1 == name {
+				count++
+			}
+		}
+	}
+	return count
+}
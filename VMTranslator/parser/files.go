@@ -0,0 +1,136 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// the name of standard input when it is not given one
+const stdinName = "Main"
+
+// ReadFiles parses a .vm file, or every .vm file of a directory.
+func ReadFiles(inputPath string, extended bool) ([]File, error) {
+	pathInfo, err := os.Stat(inputPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var inputFiles []string
+
+	if pathInfo.IsDir() {
+		entries, err := os.ReadDir(inputPath)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			if strings.HasSuffix(entry.Name(), ".vm") {
+				inputFiles = append(inputFiles, path.Join(inputPath, entry.Name()))
+			}
+		}
+	} else {
+		if !strings.HasSuffix(inputPath, ".vm") {
+			return nil, errors.New("invalid file type")
+		}
+		inputFiles = append(inputFiles, inputPath)
+	}
+
+	var files []File
+
+	for _, file := range inputFiles {
+		f, err := readFile(strings.TrimSuffix(path.Base(file), ".vm"), file, extended)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+
+	return files, nil
+}
+
+// ReadSources parses the sources given on the command line in order: .vm
+// files, directories, "-" for standard input, and NAME=PATH for a file or
+// standard input with the name NAME, which namespaces its static segment.
+// Standard input is named Main unless it is given a name. Two files with the
+// same name are an error, since they would share their statics.
+func ReadSources(sources []string, stdin io.Reader, extended bool) ([]File, error) {
+	var files []File
+	names := make(map[string]bool)
+	stdinRead := false
+
+	for _, source := range sources {
+		name, inputPath := "", source
+		if i := strings.Index(source, "="); i >= 0 && source != "-" {
+			if _, err := os.Stat(source); err != nil {
+				name, inputPath = source[:i], source[i+1:]
+				if name == "" || strings.ContainsAny(name, " \t/") {
+					return nil, fmt.Errorf("%s: invalid file name: %q", source, name)
+				}
+			}
+		}
+
+		var read []File
+
+		switch {
+		case inputPath == "-":
+			if stdinRead {
+				return nil, errors.New("standard input given more than once")
+			}
+			stdinRead = true
+
+			if name == "" {
+				name = stdinName
+			}
+
+			commands, err := Parse(stdin, extended)
+			if err != nil {
+				return nil, fmt.Errorf("standard input: %w", err)
+			}
+			read = []File{{Name: name, Commands: commands}}
+
+		case name != "":
+			f, err := readFile(name, inputPath, extended)
+			if err != nil {
+				return nil, err
+			}
+			read = []File{f}
+
+		default:
+			var err error
+			read, err = ReadFiles(inputPath, extended)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for _, f := range read {
+			if names[f.Name] {
+				return nil, fmt.Errorf("%s: more than one file named %s", source, f.Name)
+			}
+			names[f.Name] = true
+		}
+
+		files = append(files, read...)
+	}
+
+	return files, nil
+}
+
+func readFile(name, file string, extended bool) (File, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return File{}, err
+	}
+	defer f.Close()
+
+	commands, err := Parse(f, extended)
+	if err != nil {
+		return File{}, fmt.Errorf("%s: %w", file, err)
+	}
+
+	return File{Name: name, Commands: commands}, nil
+}
@@ -0,0 +1,366 @@
+package parser
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type CommandType int
+
+const (
+	C_ERROR CommandType = iota
+	C_ARITHMETIC
+	C_PUSH
+	C_POP
+	C_LABEL
+	C_GOTO
+	C_IF
+	C_FUNCTION
+	C_RETURN
+	C_CALL
+)
+
+var arithmeticCommands map[string]bool = map[string]bool{
+	"add": true,
+	"sub": true,
+	"neg": true,
+	"eq":  true,
+	"gt":  true,
+	"lt":  true,
+	"and": true,
+	"or":  true,
+	"not": true,
+}
+
+var extendedCommands map[string]bool = map[string]bool{
+	"mul": true,
+	"div": true,
+	"shl": true,
+	"shr": true,
+	"xor": true,
+	"le":  true,
+	"ge":  true,
+	"ne":  true,
+}
+
+var unaryCommands map[string]bool = map[string]bool{
+	"neg": true,
+	"not": true,
+	"shl": true,
+	"shr": true,
+}
+
+var indirectSegments map[string]bool = map[string]bool{
+	"argument-indirect": true,
+	"local-indirect":    true,
+	"this-indirect":     true,
+	"that-indirect":     true,
+}
+
+// Command is a single parsed VM command. Arg1 is the arithmetic command, the
+// segment, the label or the function name; Arg2 is the index, nVars or
+// nArgs, and -1 for commands without one. Namespace overrides the file name
+// that namespaces the static segment, for commands moved to another file.
+// Source is the position given by the last "// @line File.jack:N"
+// annotation before the command, Comment the comment on its own line.
+type Command struct {
+	Type      CommandType
+	Arg1      string
+	Arg2      int
+	Line      int
+	Namespace string
+	Source    string
+	Comment   string
+}
+
+// File is the parsed content of one .vm file, Name is the file name without
+// directory and extension.
+type File struct {
+	Name     string
+	Commands []Command
+}
+
+func (c Command) String() string {
+	switch c.Type {
+	case C_ARITHMETIC:
+		return c.Arg1
+	case C_PUSH, C_POP:
+		command := "push"
+		if c.Type == C_POP {
+			command = "pop"
+		}
+		if c.Arg2 < 0 {
+			return command + " " + c.Arg1
+		}
+		return fmt.Sprintf("%s %s %d", command, c.Arg1, c.Arg2)
+	case C_LABEL:
+		return "label " + c.Arg1
+	case C_GOTO:
+		return "goto " + c.Arg1
+	case C_IF:
+		return "if-goto " + c.Arg1
+	case C_FUNCTION:
+		return fmt.Sprintf("function %s %d", c.Arg1, c.Arg2)
+	case C_CALL:
+		return fmt.Sprintf("call %s %d", c.Arg1, c.Arg2)
+	case C_RETURN:
+		return "return"
+	}
+
+	return "unknown"
+}
+
+// Effect returns how many values the command pops off and pushes onto the
+// working stack of the current function.
+func (c Command) Effect() (pops, pushes int) {
+	switch c.Type {
+	case C_ARITHMETIC:
+		if unaryCommands[c.Arg1] {
+			return 1, 1
+		}
+		return 2, 1
+	case C_PUSH:
+		if indirectSegments[c.Arg1] {
+			return 1, 1
+		}
+		return 0, 1
+	case C_POP:
+		if indirectSegments[c.Arg1] {
+			return 2, 0
+		}
+		return 1, 0
+	case C_IF, C_RETURN:
+		return 1, 0
+	case C_CALL:
+		return c.Arg2, 1
+	}
+
+	return 0, 0
+}
+
+type Parser struct {
+	scanner     *bufio.Scanner
+	next        string
+	nextLine    int
+	nextComment string
+	nextSource  string
+	source      string
+	line        int
+	command     Command
+	extended    bool
+	err         error
+}
+
+func NewParser(r io.Reader, extended bool) *Parser {
+	p := Parser{
+		scanner:  bufio.NewScanner(r),
+		extended: extended,
+	}
+
+	p.scan()
+
+	return &p
+}
+
+// Parse reads all commands from r.
+func Parse(r io.Reader, extended bool) ([]Command, error) {
+	var commands []Command
+
+	p := NewParser(r, extended)
+	for p.HasMoreLines() {
+		if err := p.Advance(); err != nil {
+			return nil, err
+		}
+		commands = append(commands, p.Command())
+	}
+
+	return commands, p.Err()
+}
+
+// Functions splits commands at every function command. Commands before the
+// first function form a chunk of their own.
+func Functions(commands []Command) [][]Command {
+	var functions [][]Command
+
+	start := 0
+	for i := 1; i <= len(commands); i++ {
+		if i == len(commands) || commands[i].Type == C_FUNCTION {
+			functions = append(functions, commands[start:i])
+			start = i
+		}
+	}
+
+	return functions
+}
+
+func (p *Parser) HasMoreLines() bool {
+	return len(p.next) > 0
+}
+
+func (p *Parser) Advance() error {
+	if !p.HasMoreLines() {
+		return io.EOF
+	}
+
+	fields := strings.Fields(p.next)
+	line := p.nextLine
+	source, comment := p.nextSource, p.nextComment
+	p.scan()
+
+	commandType := p.commandType(fields)
+	if commandType == C_ERROR {
+		return fmt.Errorf("line %d: unknown command: %s", line, strings.Join(fields, " "))
+	}
+
+	command := Command{
+		Type:    commandType,
+		Arg2:    -1,
+		Line:    line,
+		Source:  source,
+		Comment: comment,
+	}
+
+	switch commandType {
+	case C_ARITHMETIC:
+		command.Arg1 = fields[0]
+	case C_RETURN:
+	default:
+		command.Arg1 = fields[1]
+	}
+
+	if len(fields) == 3 {
+		value, err := strconv.ParseInt(fields[2], 10, 16)
+		if err != nil || value < 0 {
+			return fmt.Errorf("line %d: invalid number: %s", line, fields[2])
+		}
+		command.Arg2 = int(value)
+	}
+
+	p.line = line
+	p.command = command
+
+	return nil
+}
+
+func (p *Parser) Command() Command {
+	return p.command
+}
+
+func (p *Parser) CommandType() CommandType {
+	return p.command.Type
+}
+
+func (p *Parser) Arg1() string {
+	return p.command.Arg1
+}
+
+func (p *Parser) Arg2() int {
+	return p.command.Arg2
+}
+
+// Line returns the source line of the current command.
+func (p *Parser) Line() int {
+	return p.line
+}
+
+// Err returns the first error encountered while reading the input.
+func (p *Parser) Err() error {
+	return p.err
+}
+
+func (p *Parser) scan() {
+	p.next = ""
+
+	for p.scanner.Scan() {
+		p.nextLine++
+
+		line := p.scanner.Text()
+		comment := ""
+		if i := strings.Index(line, "//"); i >= 0 {
+			line, comment = line[:i], strings.TrimSpace(line[i+2:])
+		}
+		line = strings.TrimSpace(line)
+
+		annotation, err := p.annotate(comment)
+		if err != nil {
+			p.err = fmt.Errorf("line %d: %w", p.nextLine, err)
+			return
+		}
+		if annotation {
+			comment = ""
+		}
+
+		if len(line) > 0 {
+			p.next = line
+			p.nextComment = comment
+			p.nextSource = p.source
+			return
+		}
+	}
+
+	p.err = p.scanner.Err()
+}
+
+// annotate takes the source position of a "@line File.jack:N" comment and
+// reports whether the comment was one, other comments are left alone
+func (p *Parser) annotate(comment string) (bool, error) {
+	fields := strings.Fields(comment)
+	if len(fields) == 0 || fields[0] != "@line" {
+		return false, nil
+	}
+
+	if len(fields) != 2 {
+		return true, fmt.Errorf("invalid annotation: %s", comment)
+	}
+
+	colon := strings.LastIndex(fields[1], ":")
+	if colon <= 0 {
+		return true, fmt.Errorf("invalid annotation: %s", comment)
+	}
+
+	number, err := strconv.Atoi(fields[1][colon+1:])
+	if err != nil || number <= 0 {
+		return true, fmt.Errorf("invalid annotation: %s", comment)
+	}
+
+	p.source = fields[1]
+	return true, nil
+}
+
+func (p *Parser) commandType(fields []string) CommandType {
+	switch {
+	case fields[0] == "push" && len(fields) == 3 && !indirectSegments[fields[1]]:
+		return C_PUSH
+	case fields[0] == "pop" && len(fields) == 3 && !indirectSegments[fields[1]]:
+		return C_POP
+	case fields[0] == "push" && len(fields) == 2 && p.extended && indirectSegments[fields[1]]:
+		return C_PUSH
+	case fields[0] == "pop" && len(fields) == 2 && p.extended && indirectSegments[fields[1]]:
+		return C_POP
+	case fields[0] == "label" && len(fields) == 2:
+		return C_LABEL
+	case fields[0] == "goto" && len(fields) == 2:
+		return C_GOTO
+	case fields[0] == "if-goto" && len(fields) == 2:
+		return C_IF
+	case fields[0] == "function" && len(fields) == 3:
+		return C_FUNCTION
+	case fields[0] == "call" && len(fields) == 3:
+		return C_CALL
+	case fields[0] == "return" && len(fields) == 1:
+		return C_RETURN
+	}
+
+	_, ok := arithmeticCommands[fields[0]]
+	if !ok && p.extended {
+		_, ok = extendedCommands[fields[0]]
+	}
+	if ok && len(fields) == 1 {
+		return C_ARITHMETIC
+	}
+
+	return C_ERROR
+}
@@ -0,0 +1,156 @@
+package verify
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/pcjun97/JackVMTranslator/parser"
+)
+
+type Diagnostic struct {
+	File     string
+	Line     int
+	Function string
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	if d.Function == "" {
+		return fmt.Sprintf("%s.vm:%d: %s", d.File, d.Line, d.Message)
+	}
+	return fmt.Sprintf("%s.vm:%d: %s: %s", d.File, d.Line, d.Function, d.Message)
+}
+
+type verifier struct {
+	file        string
+	function    string
+	commands    []parser.Command
+	depth       []int
+	labels      map[string]int
+	diagnostics []Diagnostic
+}
+
+// Verify checks the stack discipline of every function in the commands of
+// one file. The depth of the working stack is propagated along goto, if-goto
+// and fall-through edges, starting from 0 after the function command, and a
+// diagnostic is reported for every command that is reached with different
+// depths, pops more values than the working stack holds, or is the return
+// of an empty working stack.
+func Verify(file string, commands []parser.Command) []Diagnostic {
+	var diagnostics []Diagnostic
+
+	for _, function := range parser.Functions(commands) {
+		_, d := Depths(file, function)
+		diagnostics = append(diagnostics, d...)
+	}
+
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		return diagnostics[i].Line < diagnostics[j].Line
+	})
+
+	return diagnostics
+}
+
+// Depths returns the depth of the working stack before each command of a
+// single function, -1 for unreachable commands, along with the diagnostics
+// of the function.
+func Depths(file string, function []parser.Command) ([]int, []Diagnostic) {
+	v := verifier{
+		file:     file,
+		commands: function,
+		depth:    make([]int, len(function)),
+		labels:   make(map[string]int),
+	}
+	v.verify()
+
+	return v.depth, v.diagnostics
+}
+
+func (v *verifier) verify() {
+	first := 0
+	if v.commands[0].Type == parser.C_FUNCTION {
+		v.function = v.commands[0].Arg1
+		first = 1
+	}
+
+	for i, command := range v.commands {
+		v.depth[i] = -1
+		if command.Type == parser.C_LABEL {
+			v.labels[command.Arg1] = i
+		}
+	}
+
+	if first >= len(v.commands) {
+		return
+	}
+
+	v.depth[first] = 0
+	worklist := []int{first}
+	conflict := make(map[int]bool)
+
+	for len(worklist) > 0 {
+		i := worklist[len(worklist)-1]
+		worklist = worklist[:len(worklist)-1]
+
+		command := v.commands[i]
+		depth := v.depth[i]
+
+		pops, pushes := command.Effect()
+		if command.Type == parser.C_RETURN && depth == 0 {
+			v.report(command, "return with an empty working stack")
+		} else if pops > depth {
+			v.report(command, fmt.Sprintf("%s pops below the function frame: needs %d values, working stack holds %d", command, pops, depth))
+			pops = depth
+		}
+		depth += pushes - pops
+
+		for _, next := range v.successors(i) {
+			switch {
+			case v.depth[next] < 0:
+				v.depth[next] = depth
+				worklist = append(worklist, next)
+			case v.depth[next] != depth && !conflict[next]:
+				conflict[next] = true
+				v.report(v.commands[next], fmt.Sprintf("inconsistent stack depth at %s: %d and %d", v.commands[next], v.depth[next], depth))
+			}
+		}
+	}
+}
+
+func (v *verifier) successors(i int) []int {
+	command := v.commands[i]
+	var successors []int
+
+	switch command.Type {
+	case parser.C_RETURN:
+		return nil
+	case parser.C_GOTO, parser.C_IF:
+		target, ok := v.labels[command.Arg1]
+		if !ok {
+			v.report(command, fmt.Sprintf("undefined label %s", command.Arg1))
+		} else {
+			successors = append(successors, target)
+		}
+
+		if command.Type == parser.C_GOTO {
+			return successors
+		}
+	}
+
+	if i+1 < len(v.commands) {
+		successors = append(successors, i+1)
+	} else if v.function != "" {
+		v.report(command, "end of function reached without return")
+	}
+
+	return successors
+}
+
+func (v *verifier) report(command parser.Command, message string) {
+	v.diagnostics = append(v.diagnostics, Diagnostic{
+		File:     v.file,
+		Line:     command.Line,
+		Function: v.function,
+		Message:  message,
+	})
+}
@@ -0,0 +1,130 @@
+package jackos
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pcjun97/JackVMTranslator/vm"
+)
+
+const (
+	newLine   = 128
+	backSpace = 129
+	keyboard  = 24576
+)
+
+func (o *OS) outputFunctions() map[string]function {
+	return map[string]function{
+		"Output.init":       {0, void},
+		"Output.moveCursor": {2, void},
+		"Output.printChar": {1, func(m *vm.Machine, args []int16) (int16, error) {
+			return 0, o.print(outputChar(args[0]))
+		}},
+		"Output.printString": {1, func(m *vm.Machine, args []int16) (int16, error) {
+			s, err := goString(m, args[0])
+			if err != nil {
+				return 0, err
+			}
+
+			var b strings.Builder
+			for _, c := range s {
+				b.WriteString(outputChar(int16(c)))
+			}
+			return 0, o.print(b.String())
+		}},
+		"Output.printInt": {1, func(m *vm.Machine, args []int16) (int16, error) {
+			return 0, o.print(fmt.Sprint(args[0]))
+		}},
+		"Output.println": {0, func(m *vm.Machine, args []int16) (int16, error) {
+			return 0, o.print("\n")
+		}},
+		"Output.backSpace": {0, func(m *vm.Machine, args []int16) (int16, error) {
+			return 0, o.print("\b")
+		}},
+	}
+}
+
+func (o *OS) keyboardFunctions() map[string]function {
+	return map[string]function{
+		"Keyboard.init": {0, void},
+		"Keyboard.keyPressed": {0, func(m *vm.Machine, args []int16) (int16, error) {
+			return m.RAM[keyboard], nil
+		}},
+		"Keyboard.readChar": {0, func(m *vm.Machine, args []int16) (int16, error) {
+			c, err := o.in.ReadByte()
+			if err != nil {
+				return 0, inputError(err)
+			}
+			if c == '\n' {
+				return newLine, nil
+			}
+			return int16(c), nil
+		}},
+		"Keyboard.readLine": {1, func(m *vm.Machine, args []int16) (int16, error) {
+			line, err := o.readLine(m, args[0])
+			if err != nil {
+				return 0, err
+			}
+
+			s, err := m.Invoke("String.new", int16(len(line)))
+			if err != nil {
+				return 0, err
+			}
+			for _, c := range line {
+				if _, err := m.Invoke("String.appendChar", s, int16(c)); err != nil {
+					return 0, err
+				}
+			}
+			return s, nil
+		}},
+		"Keyboard.readInt": {1, func(m *vm.Machine, args []int16) (int16, error) {
+			line, err := o.readLine(m, args[0])
+			if err != nil {
+				return 0, err
+			}
+			return intValue(line), nil
+		}},
+	}
+}
+
+// prints the message and reads a line of input without its line ending
+func (o *OS) readLine(m *vm.Machine, message int16) (string, error) {
+	prompt, err := goString(m, message)
+	if err != nil {
+		return "", err
+	}
+	if err := o.print(prompt); err != nil {
+		return "", err
+	}
+
+	line, err := o.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", inputError(err)
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (o *OS) print(s string) error {
+	_, err := io.WriteString(o.out, s)
+	return err
+}
+
+func outputChar(c int16) string {
+	switch c {
+	case newLine:
+		return "\n"
+	case backSpace:
+		return "\b"
+	}
+	return string(rune(c))
+}
+
+func inputError(err error) error {
+	if err == io.EOF {
+		return errors.New("end of keyboard input")
+	}
+	return err
+}
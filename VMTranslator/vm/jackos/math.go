@@ -0,0 +1,50 @@
+package jackos
+
+import (
+	"errors"
+
+	"github.com/pcjun97/JackVMTranslator/vm"
+)
+
+func (o *OS) mathFunctions() map[string]function {
+	return map[string]function{
+		"Math.init": {0, void},
+		"Math.abs": {1, func(m *vm.Machine, args []int16) (int16, error) {
+			if args[0] < 0 {
+				return -args[0], nil
+			}
+			return args[0], nil
+		}},
+		"Math.multiply": {2, func(m *vm.Machine, args []int16) (int16, error) {
+			return args[0] * args[1], nil
+		}},
+		"Math.divide": {2, func(m *vm.Machine, args []int16) (int16, error) {
+			if args[1] == 0 {
+				return 0, errors.New("division by zero")
+			}
+			return args[0] / args[1], nil
+		}},
+		"Math.sqrt": {1, func(m *vm.Machine, args []int16) (int16, error) {
+			if args[0] < 0 {
+				return 0, errors.New("cannot compute square root of a negative number")
+			}
+			y := int16(0)
+			for (int(y)+1)*(int(y)+1) <= int(args[0]) {
+				y++
+			}
+			return y, nil
+		}},
+		"Math.max": {2, func(m *vm.Machine, args []int16) (int16, error) {
+			if args[0] > args[1] {
+				return args[0], nil
+			}
+			return args[1], nil
+		}},
+		"Math.min": {2, func(m *vm.Machine, args []int16) (int16, error) {
+			if args[0] < args[1] {
+				return args[0], nil
+			}
+			return args[1], nil
+		}},
+	}
+}
@@ -0,0 +1,167 @@
+package jackos
+
+import (
+	"errors"
+
+	"github.com/pcjun97/JackVMTranslator/vm"
+)
+
+const (
+	heapBase = 2048
+	heapEnd  = 16384
+)
+
+// the heap is the free list of projects/12: every block starts with its size
+// including the header, free blocks link to the next one in their second
+// word, and the block returned by alloc starts after its size
+func (o *OS) memoryFunctions() map[string]function {
+	return map[string]function{
+		"Memory.init": {0, func(m *vm.Machine, args []int16) (int16, error) {
+			o.initHeap(m)
+			return 0, nil
+		}},
+		"Memory.peek": {1, func(m *vm.Machine, args []int16) (int16, error) {
+			return m.Peek(int(args[0]))
+		}},
+		"Memory.poke": {2, func(m *vm.Machine, args []int16) (int16, error) {
+			return 0, m.Poke(int(args[0]), args[1])
+		}},
+		"Memory.alloc": {1, func(m *vm.Machine, args []int16) (int16, error) {
+			return o.alloc(m, int(args[0]))
+		}},
+		"Memory.deAlloc": {1, func(m *vm.Machine, args []int16) (int16, error) {
+			return 0, o.deAlloc(m, int(args[0]))
+		}},
+	}
+}
+
+func (o *OS) arrayFunctions() map[string]function {
+	return map[string]function{
+		"Array.new": {1, func(m *vm.Machine, args []int16) (int16, error) {
+			if args[0] <= 0 {
+				return 0, errors.New("array size must be positive")
+			}
+			return m.Invoke("Memory.alloc", args[0])
+		}},
+		"Array.dispose": {1, func(m *vm.Machine, args []int16) (int16, error) {
+			return m.Invoke("Memory.deAlloc", args[0])
+		}},
+	}
+}
+
+func (o *OS) initHeap(m *vm.Machine) {
+	o.freeList = heapBase
+	m.RAM[heapBase] = heapEnd - heapBase
+	m.RAM[heapBase+1] = 0
+	o.heapReady = true
+}
+
+func (o *OS) alloc(m *vm.Machine, size int) (int16, error) {
+	if size < 0 {
+		return 0, errors.New("allocated memory size must be positive")
+	}
+	if size == 0 {
+		size = 1
+	}
+
+	if !o.heapReady {
+		o.initHeap(m)
+	}
+
+	prev := 0
+	free := o.freeList
+	freeSize, next := 0, 0
+
+	for free != 0 {
+		var err error
+		if freeSize, next, err = heapBlock(m, free); err != nil {
+			return 0, err
+		}
+		if freeSize >= size+2 {
+			break
+		}
+		prev, free = free, next
+	}
+
+	if free == 0 {
+		return 0, errors.New("heap overflow")
+	}
+
+	block := free
+	rest := freeSize - size - 1
+	m.RAM[block] = int16(size + 1)
+
+	free = block + size + 1
+	if rest >= 2 && free < heapEnd {
+		m.RAM[free] = int16(rest)
+		m.RAM[free+1] = int16(next)
+	} else {
+		m.RAM[block] += int16(rest)
+		free = next
+	}
+
+	if prev == 0 {
+		o.freeList = free
+	} else {
+		m.RAM[prev+1] = int16(free)
+	}
+
+	return int16(block + 1), nil
+}
+
+func (o *OS) deAlloc(m *vm.Machine, address int) error {
+	block := address - 1
+	if block < heapBase || block >= heapEnd {
+		return errors.New("address is not on the heap")
+	}
+
+	prev := 0
+	free := o.freeList
+	freeSize, next := 0, 0
+
+	for free != 0 {
+		var err error
+		if freeSize, next, err = heapBlock(m, free); err != nil {
+			return err
+		}
+		if free >= block {
+			break
+		}
+		prev, free = free, next
+	}
+
+	if free != 0 && block+int(m.RAM[block]) == free {
+		m.RAM[block] += int16(freeSize)
+		m.RAM[block+1] = int16(next)
+	} else {
+		m.RAM[block+1] = int16(free)
+	}
+
+	if prev == 0 {
+		o.freeList = block
+		return nil
+	}
+
+	if prev+int(m.RAM[prev]) == block {
+		m.RAM[prev] += m.RAM[block]
+		m.RAM[prev+1] = m.RAM[block+1]
+	} else {
+		m.RAM[prev+1] = int16(block)
+	}
+
+	return nil
+}
+
+// returns the size and the link of a block of the free list, which a
+// program writing past its objects may have broken
+func heapBlock(m *vm.Machine, block int) (int, int, error) {
+	size, err := m.Peek(block)
+	if err != nil {
+		return 0, 0, err
+	}
+	next, err := m.Peek(block + 1)
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(size), int(next), nil
+}
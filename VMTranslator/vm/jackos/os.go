@@ -0,0 +1,154 @@
+package jackos
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pcjun97/JackVMTranslator/parser"
+	"github.com/pcjun97/JackVMTranslator/vm"
+)
+
+// Classes are the classes of the Jack OS, as in projects/12.
+var Classes []string = []string{"Array", "Keyboard", "Math", "Memory", "Output", "Screen", "String", "Sys"}
+
+type function struct {
+	nArgs int
+	run   vm.Native
+}
+
+// OS implements the Jack OS in Go for the VM executor. Output writes text
+// instead of drawing characters on the screen, with newline for println,
+// and Keyboard reads characters from an input stream instead of polling
+// the keyboard, newline being reported as the newLine key. The other classes
+// work on RAM as their Jack versions do.
+type OS struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	heapReady bool
+	freeList  int
+	color     bool
+}
+
+func New(in io.Reader, out io.Writer) *OS {
+	return &OS{
+		in:    bufio.NewReader(in),
+		out:   out,
+		color: true,
+	}
+}
+
+// Install returns the files with the VM code of the selected classes added,
+// and the native functions of the selected classes. A class is left out if
+// any of the files defines a function of it, so a user's own version of a
+// class replaces the built-in one. The built-in Sys.init, which initializes
+// the classes that have an init function, built-in or the user's, and calls
+// Main.main, is only added to programs that define Main.main.
+func (o *OS) Install(files []parser.File, classes []string) ([]parser.File, map[string]vm.Native, error) {
+	defined := make(map[string]bool)
+	functionDefined := make(map[string]bool)
+	for _, file := range files {
+		for _, command := range file.Commands {
+			if command.Type == parser.C_FUNCTION {
+				defined[className(command.Arg1)] = true
+				functionDefined[command.Arg1] = true
+			}
+		}
+	}
+
+	functions := o.functions()
+	natives := make(map[string]vm.Native)
+
+	for _, class := range classes {
+		if !isClass(class) {
+			return nil, nil, fmt.Errorf("unknown OS class: %s", class)
+		}
+		if defined[class] {
+			continue
+		}
+
+		for name, f := range functions {
+			if className(name) == class {
+				natives[name] = checkArgs(f)
+			}
+		}
+
+	}
+
+	if natives["Sys.halt"] != nil && functionDefined["Main.main"] {
+		var inits []string
+		for _, class := range initOrder {
+			name := class + ".init"
+			if natives[name] != nil || functionDefined[name] {
+				inits = append(inits, name)
+			}
+		}
+
+		commands, err := parser.Parse(strings.NewReader(sysInit(inits)), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		files = append(files, parser.File{Name: "Sys", Commands: commands})
+	}
+
+	return files, natives, nil
+}
+
+func (o *OS) functions() map[string]function {
+	functions := make(map[string]function)
+
+	for _, table := range []map[string]function{
+		o.arrayFunctions(),
+		o.keyboardFunctions(),
+		o.mathFunctions(),
+		o.memoryFunctions(),
+		o.outputFunctions(),
+		o.screenFunctions(),
+		o.stringFunctions(),
+		o.sysFunctions(),
+	} {
+		for name, f := range table {
+			functions[name] = f
+		}
+	}
+
+	return functions
+}
+
+func checkArgs(f function) vm.Native {
+	return func(m *vm.Machine, args []int16) (int16, error) {
+		if len(args) != f.nArgs {
+			return 0, fmt.Errorf("expects %d arguments, called with %d", f.nArgs, len(args))
+		}
+		return f.run(m, args)
+	}
+}
+
+func className(function string) string {
+	if i := strings.Index(function, "."); i >= 0 {
+		return function[:i]
+	}
+	return function
+}
+
+func isClass(class string) bool {
+	for _, c := range Classes {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+func void(m *vm.Machine, args []int16) (int16, error) {
+	return 0, nil
+}
+
+func boolean(b bool) int16 {
+	if b {
+		return -1
+	}
+	return 0
+}
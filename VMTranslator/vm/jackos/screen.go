@@ -0,0 +1,117 @@
+package jackos
+
+import (
+	"errors"
+
+	"github.com/pcjun97/JackVMTranslator/vm"
+)
+
+const (
+	screen       = 16384
+	screenWidth  = 512
+	screenHeight = 256
+)
+
+func (o *OS) screenFunctions() map[string]function {
+	return map[string]function{
+		"Screen.init": {0, func(m *vm.Machine, args []int16) (int16, error) {
+			o.color = true
+			return 0, nil
+		}},
+		"Screen.clearScreen": {0, func(m *vm.Machine, args []int16) (int16, error) {
+			for address := screen; address < keyboard; address++ {
+				m.RAM[address] = 0
+			}
+			return 0, nil
+		}},
+		"Screen.setColor": {1, func(m *vm.Machine, args []int16) (int16, error) {
+			o.color = args[0] != 0
+			return 0, nil
+		}},
+		"Screen.drawPixel": {2, func(m *vm.Machine, args []int16) (int16, error) {
+			if !onScreen(args[0], args[1]) {
+				return 0, errors.New("illegal pixel coordinates")
+			}
+			o.drawPixel(m, int(args[0]), int(args[1]))
+			return 0, nil
+		}},
+		"Screen.drawLine": {4, func(m *vm.Machine, args []int16) (int16, error) {
+			if !onScreen(args[0], args[1]) || !onScreen(args[2], args[3]) {
+				return 0, errors.New("illegal line coordinates")
+			}
+			o.drawLine(m, int(args[0]), int(args[1]), int(args[2]), int(args[3]))
+			return 0, nil
+		}},
+		"Screen.drawRectangle": {4, func(m *vm.Machine, args []int16) (int16, error) {
+			x1, y1, x2, y2 := int(args[0]), int(args[1]), int(args[2]), int(args[3])
+			if !onScreen(args[0], args[1]) || !onScreen(args[2], args[3]) || x1 > x2 || y1 > y2 {
+				return 0, errors.New("illegal rectangle coordinates")
+			}
+			for y := y1; y <= y2; y++ {
+				o.drawLine(m, x1, y, x2, y)
+			}
+			return 0, nil
+		}},
+		"Screen.drawCircle": {3, func(m *vm.Machine, args []int16) (int16, error) {
+			x, y, r := int(args[0]), int(args[1]), int(args[2])
+			if !onScreen(args[0], args[1]) {
+				return 0, errors.New("illegal center coordinates")
+			}
+			if r < 0 || r > 181 || x-r < 0 || x+r >= screenWidth || y-r < 0 || y+r >= screenHeight {
+				return 0, errors.New("illegal radius")
+			}
+			for dy := -r; dy <= r; dy++ {
+				dx := 0
+				for (dx+1)*(dx+1) <= r*r-dy*dy {
+					dx++
+				}
+				o.drawLine(m, x-dx, y+dy, x+dx, y+dy)
+			}
+			return 0, nil
+		}},
+	}
+}
+
+func onScreen(x, y int16) bool {
+	return x >= 0 && x < screenWidth && y >= 0 && y < screenHeight
+}
+
+func (o *OS) drawPixel(m *vm.Machine, x, y int) {
+	address := screen + y*32 + x/16
+	mask := int16(1) << (x % 16)
+
+	if o.color {
+		m.RAM[address] |= mask
+	} else {
+		m.RAM[address] &^= mask
+	}
+}
+
+// Bresenham's line algorithm, for lines in every direction
+func (o *OS) drawLine(m *vm.Machine, x1, y1, x2, y2 int) {
+	dx, sx := x2-x1, 1
+	if dx < 0 {
+		dx, sx = -dx, -1
+	}
+	dy, sy := y2-y1, 1
+	if dy < 0 {
+		dy, sy = -dy, -1
+	}
+
+	diff := dx - dy
+	for {
+		o.drawPixel(m, x1, y1)
+		if x1 == x2 && y1 == y2 {
+			return
+		}
+
+		if 2*diff > -dy {
+			diff -= dy
+			x1 += sx
+		}
+		if 2*diff < dx {
+			diff += dx
+			y1 += sy
+		}
+	}
+}
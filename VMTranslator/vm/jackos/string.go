@@ -0,0 +1,224 @@
+package jackos
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/pcjun97/JackVMTranslator/vm"
+)
+
+// a string has the fields of projects/12: the character array, the length
+// and the capacity
+const (
+	stringChars = iota
+	stringLength
+	stringCapacity
+	stringSize
+)
+
+func (o *OS) stringFunctions() map[string]function {
+	return map[string]function{
+		"String.new": {1, func(m *vm.Machine, args []int16) (int16, error) {
+			capacity := args[0]
+			if capacity < 0 {
+				return 0, errors.New("maximum length must be non-negative")
+			}
+			if capacity == 0 {
+				capacity = 1
+			}
+
+			this, err := m.Invoke("Memory.alloc", stringSize)
+			if err != nil {
+				return 0, err
+			}
+
+			chars, err := m.Invoke("Array.new", capacity)
+			if err != nil {
+				return 0, err
+			}
+
+			for i, value := range []int16{chars, 0, capacity} {
+				if err := m.Poke(int(this)+i, value); err != nil {
+					return 0, err
+				}
+			}
+
+			return this, nil
+		}},
+		"String.dispose": {1, func(m *vm.Machine, args []int16) (int16, error) {
+			chars, err := field(m, args[0], stringChars)
+			if err != nil {
+				return 0, err
+			}
+			if _, err := m.Invoke("Array.dispose", m.RAM[chars]); err != nil {
+				return 0, err
+			}
+			return m.Invoke("Memory.deAlloc", args[0])
+		}},
+		"String.length": {1, func(m *vm.Machine, args []int16) (int16, error) {
+			length, err := field(m, args[0], stringLength)
+			if err != nil {
+				return 0, err
+			}
+			return m.RAM[length], nil
+		}},
+		"String.charAt": {2, func(m *vm.Machine, args []int16) (int16, error) {
+			address, err := charAddress(m, args[0], args[1])
+			if err != nil {
+				return 0, err
+			}
+			return m.Peek(address)
+		}},
+		"String.setCharAt": {3, func(m *vm.Machine, args []int16) (int16, error) {
+			address, err := charAddress(m, args[0], args[1])
+			if err != nil {
+				return 0, err
+			}
+			return 0, m.Poke(address, args[2])
+		}},
+		"String.appendChar": {2, func(m *vm.Machine, args []int16) (int16, error) {
+			return args[0], appendChar(m, args[0], args[1])
+		}},
+		"String.eraseLastChar": {1, func(m *vm.Machine, args []int16) (int16, error) {
+			length, err := field(m, args[0], stringLength)
+			if err != nil {
+				return 0, err
+			}
+			if m.RAM[length] == 0 {
+				return 0, errors.New("string is empty")
+			}
+			m.RAM[length]--
+			return 0, nil
+		}},
+		"String.intValue": {1, func(m *vm.Machine, args []int16) (int16, error) {
+			s, err := goString(m, args[0])
+			if err != nil {
+				return 0, err
+			}
+			return intValue(s), nil
+		}},
+		"String.setInt": {2, func(m *vm.Machine, args []int16) (int16, error) {
+			length, err := field(m, args[0], stringLength)
+			if err != nil {
+				return 0, err
+			}
+			m.RAM[length] = 0
+
+			for _, c := range strconv.Itoa(int(args[1])) {
+				if err := appendChar(m, args[0], int16(c)); err != nil {
+					return 0, err
+				}
+			}
+			return 0, nil
+		}},
+		"String.newLine": {0, func(m *vm.Machine, args []int16) (int16, error) {
+			return newLine, nil
+		}},
+		"String.backSpace": {0, func(m *vm.Machine, args []int16) (int16, error) {
+			return backSpace, nil
+		}},
+		"String.doubleQuote": {0, func(m *vm.Machine, args []int16) (int16, error) {
+			return '"', nil
+		}},
+	}
+}
+
+// returns the address of a field of a string object
+func field(m *vm.Machine, this int16, index int) (int, error) {
+	if this <= 0 || int(this)+stringSize > vm.RAMSize {
+		return 0, errors.New("invalid string")
+	}
+	return int(this) + index, nil
+}
+
+func charAddress(m *vm.Machine, this int16, index int16) (int, error) {
+	length, err := field(m, this, stringLength)
+	if err != nil {
+		return 0, err
+	}
+	if index < 0 || index >= m.RAM[length] {
+		return 0, errors.New("string index out of bounds")
+	}
+	return int(m.RAM[int(this)+stringChars]) + int(index), nil
+}
+
+// appends a character, doubling the capacity of a full string as the
+// projects/12 version does
+func appendChar(m *vm.Machine, this int16, c int16) error {
+	length, err := field(m, this, stringLength)
+	if err != nil {
+		return err
+	}
+
+	chars := int(this) + stringChars
+	capacity := int(this) + stringCapacity
+
+	if m.RAM[length] >= m.RAM[capacity] {
+		grown, err := m.Invoke("Array.new", 2*m.RAM[capacity])
+		if err != nil {
+			return err
+		}
+		for i := 0; i < int(m.RAM[length]); i++ {
+			c, err := m.Peek(int(m.RAM[chars]) + i)
+			if err != nil {
+				return err
+			}
+			if err := m.Poke(int(grown)+i, c); err != nil {
+				return err
+			}
+		}
+		if _, err := m.Invoke("Array.dispose", m.RAM[chars]); err != nil {
+			return err
+		}
+		m.RAM[chars] = grown
+		m.RAM[capacity] *= 2
+	}
+
+	if err := m.Poke(int(m.RAM[chars])+int(m.RAM[length]), c); err != nil {
+		return err
+	}
+	m.RAM[length]++
+
+	return nil
+}
+
+// reads a string object through String.length and String.charAt, so it
+// works with a user's own String class as well
+func goString(m *vm.Machine, this int16) (string, error) {
+	length, err := m.Invoke("String.length", this)
+	if err != nil {
+		return "", err
+	}
+
+	s := make([]rune, 0, length)
+	for i := int16(0); i < length; i++ {
+		c, err := m.Invoke("String.charAt", this, i)
+		if err != nil {
+			return "", err
+		}
+		s = append(s, rune(c))
+	}
+
+	return string(s), nil
+}
+
+// parses the leading digits, with an optional minus sign, as projects/12 does
+func intValue(s string) int16 {
+	value := int16(0)
+	negative := len(s) > 0 && s[0] == '-'
+	if negative {
+		s = s[1:]
+	}
+
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			break
+		}
+		value = value*10 + int16(c-'0')
+	}
+
+	if negative {
+		return -value
+	}
+	return value
+}
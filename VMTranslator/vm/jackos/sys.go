@@ -0,0 +1,45 @@
+package jackos
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pcjun97/JackVMTranslator/vm"
+)
+
+// the classes Sys.init initializes, in the order of projects/12
+var initOrder []string = []string{"Memory", "Math", "Screen", "Output", "Keyboard"}
+
+// Sys.init is VM code, see sysInit, so that Main.main runs as VM commands
+// that can be stepped through
+func (o *OS) sysFunctions() map[string]function {
+	return map[string]function{
+		"Sys.halt": {0, func(m *vm.Machine, args []int16) (int16, error) {
+			return 0, vm.ErrHalted
+		}},
+		"Sys.wait": {1, func(m *vm.Machine, args []int16) (int16, error) {
+			if args[0] < 0 {
+				return 0, errors.New("duration must be positive")
+			}
+			return 0, nil
+		}},
+		"Sys.error": {1, func(m *vm.Machine, args []int16) (int16, error) {
+			return 0, fmt.Errorf("ERR %d", args[0])
+		}},
+	}
+}
+
+// returns the VM code of Sys.init, which calls the init functions, then
+// Main.main, then Sys.halt
+func sysInit(inits []string) string {
+	var b strings.Builder
+
+	b.WriteString("function Sys.init 0\n")
+	for _, name := range append(inits, "Main.main", "Sys.halt") {
+		fmt.Fprintf(&b, "call %s 0\npop temp 0\n", name)
+	}
+	b.WriteString("push constant 0\nreturn\n")
+
+	return b.String()
+}
@@ -0,0 +1,575 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pcjun97/JackVMTranslator/parser"
+)
+
+const (
+	SP   = 0
+	LCL  = 1
+	ARG  = 2
+	THIS = 3
+	THAT = 4
+
+	RAMSize = 32768
+)
+
+var segmentBase map[string]int = map[string]int{
+	"local":    LCL,
+	"argument": ARG,
+	"this":     THIS,
+	"that":     THAT,
+}
+
+var indirectBase map[string]int = map[string]int{
+	"local-indirect":    LCL,
+	"argument-indirect": ARG,
+	"this-indirect":     THIS,
+	"that-indirect":     THAT,
+}
+
+var segmentSize map[string]int = map[string]int{
+	"pointer": 2,
+	"temp":    8,
+}
+
+var segmentFixed map[string]int = map[string]int{
+	"pointer": 3,
+	"temp":    5,
+}
+
+var ErrHalted error = errors.New("machine halted")
+
+// Native is a function implemented in Go. It receives the arguments of the
+// call in order and returns the value the call pushes.
+type Native func(m *Machine, args []int16) (int16, error)
+
+// Instruction is a command of the loaded program along with the file it
+// comes from and the function it belongs to.
+type Instruction struct {
+	File     string
+	Function string
+	Command  parser.Command
+}
+
+func (i Instruction) String() string {
+	s := fmt.Sprintf("%s.vm:%d: %s: %s", i.File, i.Command.Line, i.Function, i.Command)
+	if i.Function == "" {
+		s = fmt.Sprintf("%s.vm:%d: %s", i.File, i.Command.Line, i.Command)
+	}
+
+	if i.Command.Source != "" {
+		s += " (" + i.Command.Source + ")"
+	}
+	return s
+}
+
+// Frame is a function call in progress. Return is the index of the
+// instruction after the call, -1 for the bootstrap call of Sys.init.
+type Frame struct {
+	Function string
+	Return   int
+}
+
+// Machine executes VM commands directly. RAM is laid out as on the Hack
+// platform: the stack starts at 256, the segment pointers live in RAM[1..4]
+// and every call pushes the same five word frame, with the index of the
+// return instruction as return address. Statics are allocated from 16 in
+// order of appearance, the same way the Hack assembler allocates them for
+// translated code.
+type Machine struct {
+	RAM     [RAMSize]int16
+	PC      int
+	Program []Instruction
+	Frames  []Frame
+	Halted  bool
+
+	functions map[string]int
+	natives   map[string]Native
+	labels    map[string]int
+	statics   map[string]int
+}
+
+// Load builds a machine for the files and the native functions, a function
+// defined in the files takes precedence over a native one. If Sys.init is
+// defined it is called the way the translator's bootstrap code calls it,
+// otherwise execution starts at the first command with SP set to 256.
+func Load(files []parser.File, natives map[string]Native) (*Machine, error) {
+	m := Machine{
+		functions: make(map[string]int),
+		natives:   natives,
+		labels:    make(map[string]int),
+		statics:   make(map[string]int),
+	}
+
+	for _, file := range files {
+		function := ""
+
+		for _, command := range file.Commands {
+			i := Instruction{File: file.Name, Command: command}
+
+			switch command.Type {
+			case parser.C_FUNCTION:
+				if _, ok := m.functions[command.Arg1]; ok {
+					return nil, fmt.Errorf("%s.vm:%d: function %s already defined", file.Name, command.Line, command.Arg1)
+				}
+				function = command.Arg1
+				m.functions[function] = len(m.Program)
+			case parser.C_LABEL:
+				label := function + "$" + command.Arg1
+				if _, ok := m.labels[label]; ok {
+					return nil, fmt.Errorf("%s.vm:%d: label %s already defined", file.Name, command.Line, command.Arg1)
+				}
+				m.labels[label] = len(m.Program)
+			case parser.C_PUSH, parser.C_POP:
+				if command.Arg1 == "static" {
+					m.getStatic(i)
+				}
+			}
+
+			i.Function = function
+			m.Program = append(m.Program, i)
+		}
+	}
+
+	for _, i := range m.Program {
+		if i.Command.Type != parser.C_GOTO && i.Command.Type != parser.C_IF {
+			continue
+		}
+		if _, ok := m.labels[i.Function+"$"+i.Command.Arg1]; !ok {
+			return nil, fmt.Errorf("%s: undefined label %s", i, i.Command.Arg1)
+		}
+	}
+
+	if 16+len(m.statics) > 256 {
+		return nil, fmt.Errorf("too many static variables: %d", len(m.statics))
+	}
+
+	m.RAM[SP] = 256
+	if _, ok := m.functions["Sys.init"]; ok {
+		m.call("Sys.init", 0, -1)
+	}
+
+	return &m, nil
+}
+
+// Current returns the instruction that is executed next.
+func (m *Machine) Current() (Instruction, bool) {
+	if m.Halted || m.PC >= len(m.Program) {
+		return Instruction{}, false
+	}
+	return m.Program[m.PC], true
+}
+
+// Function returns the name of the function being executed, empty outside
+// of any call.
+func (m *Machine) Function() string {
+	if len(m.Frames) == 0 {
+		return ""
+	}
+	return m.Frames[len(m.Frames)-1].Function
+}
+
+// Locals returns the number of local variables of the function being
+// executed.
+func (m *Machine) Locals() int {
+	if pc, ok := m.functions[m.Function()]; ok {
+		return m.Program[pc].Command.Arg2
+	}
+	return 0
+}
+
+// Arguments returns the number of arguments of the function being executed.
+func (m *Machine) Arguments() int {
+	if len(m.Frames) == 0 {
+		return 0
+	}
+	return int(m.RAM[LCL]) - 5 - int(m.RAM[ARG])
+}
+
+// Step executes the next instruction. Running past the last instruction,
+// returning from the outermost call or a goto to the label right before it
+// halts the machine.
+func (m *Machine) Step() error {
+	i, ok := m.Current()
+	if !ok {
+		m.Halted = true
+		return ErrHalted
+	}
+
+	pc := m.PC
+	m.PC++
+	if err := m.execute(i); err != nil {
+		if errors.Is(err, ErrHalted) {
+			m.Halted = true
+			return nil
+		}
+		m.PC = pc
+		return fmt.Errorf("%s: %w", i, err)
+	}
+
+	if m.PC >= len(m.Program) {
+		m.Halted = true
+	}
+
+	return nil
+}
+
+func (m *Machine) execute(i Instruction) error {
+	command := i.Command
+
+	switch command.Type {
+	case parser.C_ARITHMETIC:
+		return m.arithmetic(command.Arg1)
+	case parser.C_PUSH:
+		return m.push(i)
+	case parser.C_POP:
+		return m.pop(i)
+	case parser.C_LABEL:
+	case parser.C_GOTO:
+		target := m.labels[i.Function+"$"+command.Arg1]
+		if target == m.PC-2 {
+			// label X, goto X is the idiom for halting
+			m.Halted = true
+		}
+		m.PC = target
+	case parser.C_IF:
+		value, err := m.Pop()
+		if err != nil {
+			return err
+		}
+		if value != 0 {
+			m.PC = m.labels[i.Function+"$"+command.Arg1]
+		}
+	case parser.C_FUNCTION:
+		for j := 0; j < command.Arg2; j++ {
+			if err := m.Push(0); err != nil {
+				return err
+			}
+		}
+	case parser.C_CALL:
+		return m.call(command.Arg1, command.Arg2, m.PC)
+	case parser.C_RETURN:
+		return m.ret()
+	}
+
+	return nil
+}
+
+func (m *Machine) arithmetic(command string) error {
+	y, err := m.Pop()
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "neg":
+		return m.Push(-y)
+	case "not":
+		return m.Push(^y)
+	case "shl":
+		return m.Push(y * 2)
+	case "shr":
+		return m.Push(y / 2)
+	}
+
+	x, err := m.Pop()
+	if err != nil {
+		return err
+	}
+
+	var result int16
+
+	switch command {
+	case "add":
+		result = x + y
+	case "sub":
+		result = x - y
+	case "and":
+		result = x & y
+	case "or":
+		result = x | y
+	case "xor":
+		result = x ^ y
+	case "mul":
+		result = x * y
+	case "div":
+		if y == 0 {
+			return errors.New("division by zero")
+		}
+		result = x / y
+	case "eq":
+		result = boolean(x == y)
+	case "gt":
+		result = boolean(x > y)
+	case "lt":
+		result = boolean(x < y)
+	case "le":
+		result = boolean(x <= y)
+	case "ge":
+		result = boolean(x >= y)
+	case "ne":
+		result = boolean(x != y)
+	default:
+		return fmt.Errorf("unknown arithmetic command: %s", command)
+	}
+
+	return m.Push(result)
+}
+
+func (m *Machine) push(i Instruction) error {
+	segment, index := i.Command.Arg1, i.Command.Arg2
+
+	if segment == "constant" {
+		return m.Push(int16(index))
+	}
+
+	if base, ok := indirectBase[segment]; ok {
+		offset, err := m.Pop()
+		if err != nil {
+			return err
+		}
+		value, err := m.Peek(int(m.RAM[base]) + int(offset))
+		if err != nil {
+			return err
+		}
+		return m.Push(value)
+	}
+
+	address, err := m.address(i)
+	if err != nil {
+		return err
+	}
+
+	value, err := m.Peek(address)
+	if err != nil {
+		return err
+	}
+
+	return m.Push(value)
+}
+
+func (m *Machine) pop(i Instruction) error {
+	segment := i.Command.Arg1
+
+	value, err := m.Pop()
+	if err != nil {
+		return err
+	}
+
+	if base, ok := indirectBase[segment]; ok {
+		offset, err := m.Pop()
+		if err != nil {
+			return err
+		}
+		return m.Poke(int(m.RAM[base])+int(offset), value)
+	}
+
+	address, err := m.address(i)
+	if err != nil {
+		return err
+	}
+
+	return m.Poke(address, value)
+}
+
+// Invoke calls a function from a native function and runs it to completion.
+func (m *Machine) Invoke(name string, args ...int16) (int16, error) {
+	pc := m.PC
+	depth := len(m.Frames)
+
+	for _, arg := range args {
+		if err := m.Push(arg); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := m.call(name, len(args), pc); err != nil {
+		return 0, err
+	}
+
+	for len(m.Frames) > depth {
+		if m.Halted {
+			return 0, ErrHalted
+		}
+		if err := m.Step(); err != nil {
+			return 0, err
+		}
+	}
+
+	m.PC = pc
+	return m.Pop()
+}
+
+func (m *Machine) call(name string, nArgs int, returnAddress int) error {
+	if _, ok := m.functions[name]; !ok {
+		native, ok := m.natives[name]
+		if !ok {
+			return fmt.Errorf("undefined function %s", name)
+		}
+		return m.callNative(name, native, nArgs, returnAddress)
+	}
+
+	for _, value := range []int16{int16(returnAddress), m.RAM[LCL], m.RAM[ARG], m.RAM[THIS], m.RAM[THAT]} {
+		if err := m.Push(value); err != nil {
+			return err
+		}
+	}
+
+	m.RAM[ARG] = m.RAM[SP] - 5 - int16(nArgs)
+	m.RAM[LCL] = m.RAM[SP]
+	m.Frames = append(m.Frames, Frame{Function: name, Return: returnAddress})
+	m.PC = m.functions[name]
+
+	return nil
+}
+
+func (m *Machine) callNative(name string, native Native, nArgs int, returnAddress int) error {
+	sp := int(m.RAM[SP])
+	if sp-nArgs < 0 {
+		return errors.New("stack underflow")
+	}
+
+	args := make([]int16, nArgs)
+	copy(args, m.RAM[sp-nArgs:sp])
+	m.RAM[SP] -= int16(nArgs)
+
+	m.Frames = append(m.Frames, Frame{Function: name, Return: returnAddress})
+	value, err := native(m, args)
+	m.Frames = m.Frames[:len(m.Frames)-1]
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	return m.Push(value)
+}
+
+func (m *Machine) ret() error {
+	if len(m.Frames) == 0 {
+		return errors.New("return outside of a function call")
+	}
+
+	frame := int(m.RAM[LCL])
+	value, err := m.Pop()
+	if err != nil {
+		return err
+	}
+
+	if err := m.Poke(int(m.RAM[ARG]), value); err != nil {
+		return err
+	}
+	m.RAM[SP] = m.RAM[ARG] + 1
+
+	for j, pointer := range []int{THAT, THIS, ARG, LCL} {
+		saved, err := m.Peek(frame - 1 - j)
+		if err != nil {
+			return err
+		}
+		m.RAM[pointer] = saved
+	}
+
+	top := m.Frames[len(m.Frames)-1]
+	m.Frames = m.Frames[:len(m.Frames)-1]
+
+	if top.Return < 0 {
+		m.Halted = true
+		return nil
+	}
+
+	m.PC = top.Return
+	return nil
+}
+
+// Push pushes a value onto the stack.
+func (m *Machine) Push(value int16) error {
+	if err := m.Poke(int(m.RAM[SP]), value); err != nil {
+		return fmt.Errorf("stack overflow: %w", err)
+	}
+	m.RAM[SP]++
+	return nil
+}
+
+// Pop pops a value off the stack.
+func (m *Machine) Pop() (int16, error) {
+	if m.RAM[SP] <= 0 {
+		return 0, errors.New("stack underflow")
+	}
+	m.RAM[SP]--
+	return m.RAM[m.RAM[SP]], nil
+}
+
+func (m *Machine) Peek(address int) (int16, error) {
+	if address < 0 || address >= RAMSize {
+		return 0, fmt.Errorf("address out of range: %d", address)
+	}
+	return m.RAM[address], nil
+}
+
+func (m *Machine) Poke(address int, value int16) error {
+	if address < 0 || address >= RAMSize {
+		return fmt.Errorf("address out of range: %d", address)
+	}
+	m.RAM[address] = value
+	return nil
+}
+
+// Address returns the RAM address of a slot of the local, argument, this,
+// that, pointer or temp segment.
+func (m *Machine) Address(segment string, index int) (int, error) {
+	if base, ok := segmentBase[segment]; ok {
+		return int(m.RAM[base]) + index, nil
+	}
+
+	if size, ok := segmentSize[segment]; ok {
+		if index < 0 || index >= size {
+			return 0, fmt.Errorf("%s index out of range: %d", segment, index)
+		}
+		return segmentFixed[segment] + index, nil
+	}
+
+	return 0, fmt.Errorf("unknown segment: %s", segment)
+}
+
+// Static returns the RAM address of a static variable of a file, false if
+// the program never uses it.
+func (m *Machine) Static(file string, index int) (int, bool) {
+	address, ok := m.statics[fmt.Sprintf("%s.%d", file, index)]
+	return address, ok
+}
+
+func (m *Machine) address(i Instruction) (int, error) {
+	if i.Command.Arg1 == "static" {
+		return m.getStatic(i), nil
+	}
+	return m.Address(i.Command.Arg1, i.Command.Arg2)
+}
+
+// statics are namespaced by file, or by the namespace of commands moved to
+// another file
+func (m *Machine) getStatic(i Instruction) int {
+	file := i.File
+	if i.Command.Namespace != "" {
+		file = i.Command.Namespace
+	}
+
+	v := fmt.Sprintf("%s.%d", file, i.Command.Arg2)
+
+	address, ok := m.statics[v]
+	if !ok {
+		address = 16 + len(m.statics)
+		m.statics[v] = address
+	}
+
+	return address
+}
+
+func boolean(b bool) int16 {
+	if b {
+		return -1
+	}
+	return 0
+}